@@ -1,13 +1,13 @@
 package bench
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"os"
 	"runtime"
 	"runtime/pprof"
-	"sync"
 	"time"
 
 	"github.com/alecthomas/kong"
@@ -19,15 +19,51 @@ import (
 const (
 	workerChannelSize = 32
 	resultChannelSize = 32
+	// abortedExitCode is the exit status when the benchmark is aborted by --max-errors, --max-error-rate or a worker error.
+	abortedExitCode = 3
 )
 
 type BenchmarkCommand struct {
-	Input        string        `default:"-" help:"input file to use, defaults to '-' for stdin" arg:"" type:"existingfile"`
-	Concurrency  uint32        `default:"4" help:"number of connections to spread the queries across"`
-	DatabaseUrl  string        `env:"DATABASE_URL" help:"postgres connection string"`
-	DatabaseWait time.Duration `default:"30s" help:"wait until the database accepts connections"`
-	Json         bool          `help:"output the report in JSON format"`
-	Profile      bool          `help:"record pprof profiles"`
+	Input            string        `default:"-" help:"input file to use, defaults to '-' for stdin" arg:"" type:"existingfile"`
+	Concurrency      uint32        `default:"4" help:"number of connections to spread the queries across"`
+	DatabaseUrl      []string      `env:"DATABASE_URL" help:"postgres connection string, repeat it or separate with commas to benchmark several databases"`
+	DatabaseWait     time.Duration `default:"30s" help:"wait until the database accepts connections"`
+	Json             bool          `help:"output the report in JSON format"`
+	Profile          bool          `help:"record pprof profiles"`
+	Query            string        `help:"SQL statement to benchmark, its $1..$n placeholders are bound to the input columns" xor:"query"`
+	QueryFile        string        `help:"file to read the SQL statement from" type:"existingfile" xor:"query"`
+	Workload         string        `help:"workload file declaring a weighted mix of statements and their inputs" type:"existingfile" xor:"query"`
+	Repeat           uint32        `help:"number of passes over the input, unlimited if --duration is set, defaults to one pass"`
+	Duration         time.Duration `help:"keep cycling over the input until this duration is elapsed"`
+	Warmup           string        `help:"exclude the start of the run from the report: a duration (30s), query count (500) or passes (1pass)"`
+	Rate             string        `help:"open-loop mode: start queries at a constant rate (500/s), independently of their completion"`
+	Arrival          string        `default:"fixed" enum:"fixed,poisson" help:"arrival times in open-loop mode: fixed intervals or poisson process"`
+	Stages           string        `help:"load profile replacing --concurrency and --duration: worker count and duration of each stage (4:1m,8:1m)"`
+	Routing          string        `default:"hash" enum:"hash,round-robin,shared-queue,least-loaded,consistent-hash" help:"strategy to spread the queries across workers"`
+	RoutingKey       string        `help:"input column to route queries on, defaults to the first column"`
+	ReportInterval   time.Duration `help:"print throughput, errors and latency for each interval while the benchmark runs"`
+	ReportFile       string        `help:"file to write the interval reports to, defaults to stderr"`
+	Percentiles      []float64     `help:"latency percentiles to report, replacing the default ones in the text report, for example 50,99,99.9,99.99"`
+	LatencyPrecision int           `default:"3" help:"significant digits of the latency histograms, from 1 to 5: each histogram takes about 200KB at 3, 2.5MB at 4 and 17MB at 5"`
+	QueryTimeout     time.Duration `help:"cancel queries running longer than this duration, and record them as timed out"`
+	StatementTimeout bool          `help:"also set statement_timeout to --query-timeout, for the server to cancel the queries"`
+	ReconnectTimeout time.Duration `default:"30s" help:"stop the benchmark if a worker cannot reconnect within this duration after a connection loss"`
+	Protocol         string        `default:"prepared" enum:"simple,extended,prepared,pipeline" help:"protocol to send the queries with: simple, extended (parsed on each execution), prepared or pipeline (batched prepared queries)"`
+	BatchSize        int           `default:"10" help:"maximum number of queries sent per round-trip in pipeline mode"`
+	Clients          uint32        `help:"pool mode: number of clients sharing a pool of --pool-size connections, replacing --concurrency"`
+	PoolSize         uint32        `help:"number of connections in the pool shared by the --clients"`
+	Fetch            bool          `help:"read the rows returned by the queries, and report their count, size and time to first row"`
+	MaxErrors        uint64        `help:"abort the benchmark once more queries than this have failed"`
+	MaxErrorRate     float64       `help:"abort the benchmark if the error rate over the last --error-window queries exceeds this percentage"`
+	ErrorWindow      int           `default:"1000" help:"number of recent queries the --max-error-rate is evaluated over"`
+	TargetPolicy     string        `default:"round-robin" enum:"round-robin,weighted,hash" help:"strategy to spread the workers across several databases: round-robin, weighted by --target-weights, or hash of the routing key"`
+	TargetWeights    []int         `help:"relative share of the workers of each database with --target-policy=weighted, for example 1,3"`
+	Breakdown        []string      `help:"latency breakdowns to add to the report: worker, key (the routing key), or both"`
+	TopKeys          int           `default:"10" help:"number of slowest routing keys listed in the text report with --breakdown=key"`
+	SampleExplain    string        `help:"run a percentage of the queries (1%) again with EXPLAIN ANALYZE on a side connection, to report their server-side execution time"`
+	StatementStats   bool          `help:"snapshot pg_stat_statements before and after the run, to report the server-side counters of the benchmarked statements, not available with --protocol=simple"`
+	DatabaseStats    time.Duration `help:"poll the database statistics (pg_stat_database, checkpoints, wait events and lock waits) at this interval, and add their time series to the report"`
+	Preflight        string        `default:"warn" enum:"strict,warn,off" help:"check before the run that the cpu_usage hypertable has data matching the input hosts and time ranges, reading the input file once more: fail, warn or skip the check"`
 }
 
 func (c *BenchmarkCommand) Run(k *kong.Context) error {
@@ -50,84 +86,386 @@ func (c *BenchmarkCommand) Run(k *kong.Context) error {
 		k.FatalIfErrorf(pprof.StartCPUProfile(f))
 	}
 
-	connect := func(ctx context.Context) (db.Conn, error) {
-		return pgx.Connect(ctx, c.DatabaseUrl)
+	ctx, stop := notifyInterrupt(context.Background())
+	defer stop()
+
+	urls := c.DatabaseUrl
+	if len(urls) == 0 {
+		// Connect with the libpq environment variables and defaults
+		urls = []string{""}
+	}
+	// Fail on invalid flags before waiting for the databases and opening the pools
+	if _, err := c.parseFlags(len(urls)); err != nil {
+		return err
+	}
+	targets := make([]target, len(urls))
+	configs := make([]*pgx.ConnConfig, len(urls))
+	connects := make([]db.ConnectFunc, len(urls))
+	for i, url := range urls {
+		config, err := pgx.ParseConfig(url)
+		if err != nil {
+			return fmt.Errorf("invalid database url: %w", err)
+		}
+		if c.Protocol == db.ProtocolExtended {
+			// Without statement cache, pgx parses and plans the queries on each execution
+			config.BuildStatementCache = nil
+		}
+		configs[i] = config
+		connects[i] = func(ctx context.Context) (db.Conn, error) {
+			return pgx.ConnectConfig(ctx, config)
+		}
+		targets[i] = target{name: targetName(config), connect: connects[i]}
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), c.DatabaseWait)
+	waitCtx, cancel := context.WithTimeout(ctx, c.DatabaseWait)
 	defer cancel()
-	k.FatalIfErrorf(db.WaitFor(ctx, connect))
+	k.FatalIfErrorf(db.WaitFor(waitCtx, connects...))
+	var dataset *stats.Dataset
+	if c.Preflight != PreflightOff {
+		var err error
+		if dataset, err = c.preflight(ctx, targets[0].connect); err != nil {
+			if c.Preflight == PreflightStrict {
+				return fmt.Errorf("preflight failed: %w", err)
+			}
+			// The benchmark runs without the dataset fingerprint
+			_, _ = fmt.Fprintf(os.Stderr, "dataset not inspected: %s\n", err)
+		}
+	}
+	metadata, err := c.newMetadata(k)
+	if err != nil {
+		return err
+	}
+	metadata.Server = readServerInfo(ctx, targets[0].connect)
 
-	report, err := c.runBench(k, connect)
+	if c.Clients > 0 {
+		for i, config := range configs {
+			pool, acquire, err := c.openPool(ctx, config)
+			if err != nil {
+				return err
+			}
+			defer pool.Close()
+			targets[i].acquire = acquire
+		}
+	}
+
+	metadata.Start = time.Now()
+	report, err := c.runBench(ctx, targets)
 	if err != nil {
 		return err
 	}
-	return report.Print(os.Stdout, c.Json)
+	metadata.End = time.Now()
+	report.Metadata = metadata
+	report.Dataset = dataset
+	if err = report.Print(os.Stdout, c.Json); err != nil {
+		return err
+	}
+	if report.Aborted != "" {
+		k.Exit(abortedExitCode)
+	}
+	return nil
+}
+
+// checkTargetHash checks that each target has workers to route its queries to with the hash target policy.
+func (c *BenchmarkCommand) checkTargetHash(stages []*phase, count int) error {
+	if c.TargetPolicy != TargetHash || count < 2 {
+		return nil
+	}
+	if c.Routing == "shared-queue" {
+		return fmt.Errorf("--target-policy=hash cannot be used with the shared-queue routing")
+	}
+	concurrency := []uint32{c.Concurrency}
+	if c.Clients > 0 {
+		concurrency[0] = c.Clients
+	}
+	if len(stages) > 0 {
+		concurrency = concurrency[:0]
+		for _, s := range stages {
+			concurrency = append(concurrency, s.concurrency)
+		}
+	}
+	for _, n := range concurrency {
+		if int(n) < count {
+			return fmt.Errorf("--target-policy=hash needs at least one worker per database, got %d workers for %d databases", n, count)
+		}
+	}
+	return nil
 }
 
-func (c *BenchmarkCommand) buildInput() (io.Reader, error) {
-	if c.Input == "-" {
-		return os.Stdin, nil
+// dbOptions returns the options of the database workers.
+func (c *BenchmarkCommand) dbOptions() db.Options {
+	return db.Options{
+		QueryTimeout:     c.QueryTimeout,
+		StatementTimeout: c.StatementTimeout,
+		ReconnectTimeout: c.ReconnectTimeout,
+		Fetch:            c.Fetch,
+		Protocol:         c.Protocol,
+		BatchSize:        c.BatchSize,
 	}
-	file, err := os.Open(c.Input)
+}
+
+// openInput opens an input file, or stdin for '-'.
+// If rewindable is set, stdin is buffered in memory to allow running several passes.
+func openInput(path string, rewindable bool) (io.Reader, error) {
+	if path == "-" {
+		if !rewindable {
+			return os.Stdin, nil
+		}
+		content, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read stdin: %w", err)
+		}
+		return bytes.NewReader(content), nil
+	}
+	file, err := os.Open(path)
 	if err != nil {
 		return nil, fmt.Errorf("cannot open input file: %w", err)
 	}
 	return file, nil
 }
 
-func (c *BenchmarkCommand) runBench(k *kong.Context, cf db.ConnectFunc) (*stats.Report, error) {
-	ctx := context.Background()
+func (c *BenchmarkCommand) buildStatement() (*db.Statement, error) {
+	switch {
+	case c.QueryFile != "":
+		return db.LoadStatement(c.QueryFile)
+	case c.Query != "":
+		return &db.Statement{Name: "query", Text: c.Query}, nil
+	default:
+		return db.DefaultStatement(), nil
+	}
+}
+
+// buildWorkload returns the workload declared by the --workload file,
+// or a single statement workload reading its parameters from the input argument.
+func (c *BenchmarkCommand) buildWorkload() (*workload, error) {
+	if c.Workload != "" {
+		if c.Input != "-" {
+			return nil, fmt.Errorf("input file cannot be used with --workload, declare it in the workload file")
+		}
+		w := &workload{routingKey: c.RoutingKey}
+		if err := w.load(c.Workload, c.multiplePasses()); err != nil {
+			return nil, err
+		}
+		return w, nil
+	}
 
-	input, err := c.buildInput()
+	stmt, err := c.buildStatement()
 	if err != nil {
 		return nil, err
 	}
-
-	queries, err := db.NewQueryParser(input)
+	input, err := openInput(c.Input, c.multiplePasses())
 	if err != nil {
 		return nil, err
 	}
+	w := &workload{routingKey: c.RoutingKey}
+	if err = w.add(stmt, input, 1); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
 
-	resultChan := make(chan stats.Result, resultChannelSize)
-	workerChan := make([]chan *db.Query, c.Concurrency)
-	workerGroup := sync.WaitGroup{}
-	workerGroup.Add(int(c.Concurrency))
+// multiplePasses returns whether the input might be read more than once.
+func (c *BenchmarkCommand) multiplePasses() bool {
+	return c.Repeat > 1 || c.Duration > 0 || c.Warmup != "" || c.Stages != ""
+}
 
-	// Spawn database workerCount
-	for i := range workerChan {
-		i := i
-		c := make(chan *db.Query, workerChannelSize)
-		workerChan[i] = c
-		go func() {
-			k.FatalIfErrorf(db.RunQueries(ctx, i, cf, c, resultChan))
-			workerGroup.Done()
-		}()
+// runFlags holds the flags parsed before the run.
+type runFlags struct {
+	warmup *phase
+	sched  *schedule // Open-loop mode if set
+	stages []*phase
+	slots  []int   // Target of each worker, modulo the slot count
+	sample float64 // Ratio of the queries run with EXPLAIN ANALYZE
+}
+
+// parseFlags parses and validates the flags, for invalid ones to fail the benchmark before connecting
+// to the databases.
+func (c *BenchmarkCommand) parseFlags(targetCount int) (*runFlags, error) {
+	f := &runFlags{}
+	var err error
+	if c.Warmup != "" {
+		if f.warmup, err = parseWarmup(c.Warmup); err != nil {
+			return nil, err
+		}
+	}
+	if c.Rate != "" {
+		interval, err := parseRate(c.Rate)
+		if err != nil {
+			return nil, err
+		}
+		f.sched = newSchedule(interval, c.Arrival == "poisson")
+	}
+	if c.Stages != "" {
+		if f.stages, err = parseStages(c.Stages); err != nil {
+			return nil, err
+		}
+	}
+	if c.LatencyPrecision < 1 || c.LatencyPrecision > 5 {
+		return nil, fmt.Errorf("latency precision must be between 1 and 5 significant digits")
+	}
+	for _, p := range c.Percentiles {
+		if p <= 0 || p > 100 {
+			return nil, fmt.Errorf("invalid percentile %g, expected a value between 0 and 100", p)
+		}
+	}
+	if c.ReportFile != "" && c.ReportInterval == 0 {
+		return nil, fmt.Errorf("--report-file cannot be used without --report-interval")
+	}
+	if (c.Clients > 0) != (c.PoolSize > 0) {
+		return nil, fmt.Errorf("--clients and --pool-size must be set together")
+	}
+	if f.slots, err = targetSlots(c.TargetPolicy, c.TargetWeights, targetCount); err != nil {
+		return nil, err
+	}
+	if err = c.checkTargetHash(f.stages, targetCount); err != nil {
+		return nil, err
+	}
+	if c.Protocol == db.ProtocolPipeline && c.BatchSize < 1 {
+		return nil, fmt.Errorf("batch size must be at least 1")
+	}
+	if c.StatementStats && c.Protocol == db.ProtocolSimple {
+		// Interpolated parameters are normalized differently than bind parameters, the statements would not match
+		return nil, fmt.Errorf("--statement-stats cannot be used with --protocol=simple")
+	}
+	if c.MaxErrorRate < 0 || c.MaxErrorRate > 100 {
+		return nil, fmt.Errorf("maximum error rate must be a percentage between 0 and 100")
+	}
+	if f.sample, err = parseSample(c.SampleExplain); err != nil {
+		return nil, err
+	}
+	for _, b := range c.Breakdown {
+		if b != "worker" && b != "key" {
+			return nil, fmt.Errorf("unknown breakdown %s, expected worker or key", b)
+		}
+	}
+	return f, nil
+}
+
+// runBench runs the benchmark until the workload is complete or the context is cancelled.
+// An interrupted run still returns the report of the queries executed so far.
+func (c *BenchmarkCommand) runBench(ctx context.Context, targets []target) (*stats.Report, error) {
+	f, err := c.parseFlags(len(targets))
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range targets {
+		if c.Clients > 0 && t.acquire == nil {
+			return nil, fmt.Errorf("connection pool is not open")
+		}
+	}
+	queries, err := c.buildWorkload()
+	if err != nil {
+		return nil, err
+	}
+	// Abort thresholds and worker errors stop the workers through their own context, to tell them apart from interruptions
+	runCtx, abort := context.WithCancel(ctx)
+	defer abort()
+	opts := stats.Options{
+		Interval:       c.ReportInterval,
+		IntervalOutput: os.Stderr,
+		Precision:      c.LatencyPrecision,
+		Percentiles:    c.Percentiles,
+		MaxErrors:      c.MaxErrors,
+		MaxErrorRate:   c.MaxErrorRate,
+		ErrorWindow:    c.ErrorWindow,
+		Abort:          abort,
+		TopKeys:        c.TopKeys,
+	}
+	for _, b := range c.Breakdown {
+		opts.WorkerBreakdown = opts.WorkerBreakdown || b == "worker"
+		opts.KeyBreakdown = opts.KeyBreakdown || b == "key"
+	}
+	for _, t := range targets {
+		opts.Targets = append(opts.Targets, t.name)
+	}
+	if c.ReportFile != "" {
+		f, err := os.Create(c.ReportFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create report file: %w", err)
+		}
+		defer func() { _ = f.Close() }()
+		opts.IntervalOutput = f
 	}
 
-	// Spawn a goroutine to close the results channel when all workerCount have returned
-	go func() {
-		workerGroup.Wait()
-		close(resultChan)
-	}()
+	var snapshot *statementSnapshot
+	if c.StatementStats {
+		snapshot = snapshotStatements(ctx, targets[0].connect, queries.statements())
+	}
 
-	// Spawn a goroutine to feed queries to the workerCount
-	go func() {
-		for {
-			q, e := queries.Read()
-			if e == io.EOF {
-				break
-			}
-			if e != nil { // Skip and report parsing errors
-				resultChan <- stats.Result{Err: e}
-				continue
-			}
-			workerChan[int(q.Hash()%uint64(c.Concurrency))] <- q
+	var poller *databasePoller
+	if c.DatabaseStats > 0 {
+		poller = startDatabasePoller(ctx, targets[0].connect, c.DatabaseStats)
+	}
+
+	// Spawn database workers, for the first stage if set
+	pool := &workers{
+		ctx:        runCtx,
+		targets:    targets,
+		slots:      f.slots,
+		statements: queries.statements(),
+		options:    c.dbOptions(),
+		resultChan: make(chan stats.Result, resultChannelSize),
+		abort:      abort,
+	}
+	if c.Routing == "shared-queue" {
+		pool.shared = make(chan *db.Query, workerChannelSize)
+	} else if c.TargetPolicy == TargetHash && len(targets) > 1 {
+		if pool.router, err = newTargetRouter(c.Routing, len(targets)); err != nil {
+			return nil, err
 		}
-		for _, c := range workerChan {
-			close(c)
+	} else if pool.router, err = newRouter(c.Routing); err != nil {
+		return nil, err
+	}
+	if f.sample > 0 {
+		pool.explain(newSampler(f.sample))
+	}
+	concurrency := c.Concurrency
+	if c.Clients > 0 {
+		concurrency = c.Clients
+	}
+	if len(f.stages) > 0 {
+		concurrency = 0
+		for _, s := range f.stages {
+			if s.concurrency > concurrency {
+				concurrency = s.concurrency
+			}
 		}
-	}()
+		pool.resize(int(f.stages[0].concurrency))
+	} else {
+		pool.resize(int(concurrency))
+	}
+
+	// Spawn a goroutine to feed queries to the workers
+	feed := &feeder{
+		ctx:        runCtx,
+		queries:    queries,
+		workers:    pool,
+		resultChan: pool.resultChan,
+		schedule:   f.sched,
+	}
+	go feed.run(f.warmup, c.measurePhases(f.stages))
 
 	// Collect results and build the statistics report
-	return stats.ReadResults(c.Concurrency, resultChan), nil
+	report := stats.ReadResults(concurrency, pool.resultChan, opts)
+	report.BenchPasses = feed.passes
+	report.PoolSize = c.PoolSize
+	if pool.err != nil && report.Aborted == "" {
+		report.Aborted = pool.err.Error()
+	}
+	if snapshot != nil {
+		report.ServerStatements = snapshot.deltas()
+	}
+	if poller != nil {
+		report.DatabaseStats = poller.stop()
+	}
+	report.Interrupted = ctx.Err() != nil
+	if f.sched != nil {
+		report.Schedule = f.sched.summary()
+	}
+	for i, s := range report.Stages {
+		if i < len(f.stages) && i < len(feed.elapsed) {
+			s.Concurrency = f.stages[i].concurrency
+			s.Duration = float64(feed.elapsed[i]) / float64(time.Millisecond)
+			s.Throughput = float64(s.QueriesOk+s.QueriesErr) / feed.elapsed[i].Seconds()
+		}
+	}
+	return report, nil
 }
@@ -3,6 +3,9 @@ package bench
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -10,6 +13,7 @@ import (
 	"github.com/alecthomas/kong"
 	"github.com/golang/mock/gomock"
 	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/xvello/pgbench/internal/db"
@@ -22,6 +26,13 @@ const (
 	workerCount = 4
 )
 
+// connectTo returns a single target connecting to the given mock.
+func connectTo(conn db.Conn) []target {
+	return []target{{connect: func(ctx context.Context) (db.Conn, error) {
+		return conn, nil
+	}}}
+}
+
 // TestRunBenchmark is a functional test of the whole pipeline running 200 queries, with only the DB mocked.
 func TestRunBenchmark(t *testing.T) {
 	c := gomock.NewController(t)
@@ -30,7 +41,7 @@ func TestRunBenchmark(t *testing.T) {
 
 	conn.EXPECT().
 		Prepare(gomock.Any(), db.TimeBucketQueryName, db.TimeBucketQueryText).
-		Return(&pgconn.StatementDescription{}, nil).
+		Return(&pgconn.StatementDescription{ParamOIDs: []uint32{25, 1114, 1114}}, nil).
 		Times(workerCount)
 	conn.EXPECT().
 		Exec(gomock.Any(), db.TimeBucketQueryName, gomock.Any(), gomock.Any(), gomock.Any()).
@@ -45,22 +56,27 @@ func TestRunBenchmark(t *testing.T) {
 			time.Sleep(time.Microsecond)
 			return pgconn.CommandTag{}, nil
 		}).Times(queryCount)
+	// Failed queries keep the connection open
+	conn.EXPECT().
+		IsClosed().
+		Return(false).
+		Times(queryCount / 100)
 	conn.EXPECT().
 		Close(gomock.Any()).
 		Return(nil).
 		Times(workerCount)
 
 	cmd := &BenchmarkCommand{
-		Input:       inputFile,
-		Concurrency: workerCount,
+		LatencyPrecision: 3,
+		Input:            inputFile,
+		Concurrency:      workerCount,
 	}
-	stats, err := cmd.runBench(&kong.Context{}, func(ctx context.Context) (db.Conn, error) {
-		return conn, nil
-	})
+	stats, err := cmd.runBench(context.Background(), connectTo(conn))
 	require.NoError(t, err)
 
 	// Check concurrency and work sharing
 	assert.EqualValues(t, workerCount, stats.BenchConcurrency)
+	assert.EqualValues(t, 1, stats.BenchPasses)
 	assert.Greater(t, stats.BenchDuration, 1.)
 	require.Len(t, stats.QueriesPerWorker, 4)
 	for i, v := range stats.QueriesPerWorker {
@@ -84,4 +100,798 @@ func TestRunBenchmark(t *testing.T) {
 	assert.Greater(t, stats.P99, 1.)
 	assert.Greater(t, stats.Max, 1.)
 	assert.Greater(t, stats.Sum, 20.)
+
+	// Queries wait in the worker queues in closed-loop mode, which is not flagged
+	require.NotNil(t, stats.QueueWait)
+	assert.Greater(t, stats.QueueWait.Max, 0.)
+	assert.False(t, stats.QueueBound)
+}
+
+// TestRunBenchmark_Workload checks that the statements of a workload are all prepared and reported separately.
+func TestRunBenchmark_Workload(t *testing.T) {
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+
+	conn.EXPECT().
+		Prepare(gomock.Any(), db.TimeBucketQueryName, gomock.Any()).
+		Return(&pgconn.StatementDescription{ParamOIDs: []uint32{25, 1114, 1114}}, nil).
+		Times(workerCount)
+	conn.EXPECT().
+		Prepare(gomock.Any(), "last-point", gomock.Any()).
+		Return(&pgconn.StatementDescription{ParamOIDs: []uint32{25}}, nil).
+		Times(workerCount)
+	conn.EXPECT().
+		Exec(gomock.Any(), db.TimeBucketQueryName, gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(pgconn.CommandTag{}, nil).
+		Times(32)
+	conn.EXPECT().
+		Exec(gomock.Any(), "last-point", gomock.Any()).
+		Return(pgconn.CommandTag{}, nil).
+		Times(10)
+	conn.EXPECT().
+		Close(gomock.Any()).
+		Return(nil).
+		Times(workerCount)
+
+	cmd := &BenchmarkCommand{
+		LatencyPrecision: 3,
+		Input:            "-",
+		Concurrency:      workerCount,
+		Workload:         "testdata/workload.yaml",
+	}
+	stats, err := cmd.runBench(context.Background(), connectTo(conn))
+	require.NoError(t, err)
+	assert.EqualValues(t, 42, stats.QueriesOk)
+	require.Len(t, stats.Statements, 2)
+	assert.EqualValues(t, 32, stats.Statements[db.TimeBucketQueryName].QueriesOk)
+	assert.EqualValues(t, 10, stats.Statements["last-point"].QueriesOk)
+}
+
+func TestRunBenchmark_Repeat(t *testing.T) {
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+	conn.EXPECT().
+		Prepare(gomock.Any(), db.TimeBucketQueryName, db.TimeBucketQueryText).
+		Return(&pgconn.StatementDescription{ParamOIDs: []uint32{25, 1114, 1114}}, nil).
+		Times(workerCount)
+	conn.EXPECT().
+		Exec(gomock.Any(), db.TimeBucketQueryName, gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(pgconn.CommandTag{}, nil).
+		Times(3 * queryCount)
+	conn.EXPECT().
+		Close(gomock.Any()).
+		Return(nil).
+		Times(workerCount)
+
+	cmd := &BenchmarkCommand{
+		LatencyPrecision: 3,
+		Input:            inputFile,
+		Concurrency:      workerCount,
+		Repeat:           3,
+		Duration:         time.Hour,
+	}
+	stats, err := cmd.runBench(context.Background(), connectTo(conn))
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, stats.BenchPasses)
+	assert.EqualValues(t, 3*queryCount, stats.QueriesOk)
+}
+
+func TestRunBenchmark_Duration(t *testing.T) {
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+	conn.EXPECT().
+		Prepare(gomock.Any(), db.TimeBucketQueryName, db.TimeBucketQueryText).
+		Return(&pgconn.StatementDescription{ParamOIDs: []uint32{25, 1114, 1114}}, nil).
+		Times(workerCount)
+	conn.EXPECT().
+		Exec(gomock.Any(), db.TimeBucketQueryName, gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, _ ...interface{}) (pgconn.CommandTag, error) {
+			time.Sleep(10 * time.Microsecond)
+			return pgconn.CommandTag{}, nil
+		}).
+		AnyTimes()
+	conn.EXPECT().
+		Close(gomock.Any()).
+		Return(nil).
+		Times(workerCount)
+
+	cmd := &BenchmarkCommand{
+		LatencyPrecision: 3,
+		Input:            inputFile,
+		Concurrency:      workerCount,
+		Duration:         100 * time.Millisecond,
+	}
+	start := time.Now()
+	stats, err := cmd.runBench(context.Background(), connectTo(conn))
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), cmd.Duration)
+	assert.Greater(t, stats.BenchPasses, uint64(1))
+	assert.GreaterOrEqual(t, stats.QueriesOk, stats.BenchPasses*queryCount)
+}
+
+func TestRunBenchmark_Warmup(t *testing.T) {
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+	conn.EXPECT().
+		Prepare(gomock.Any(), db.TimeBucketQueryName, db.TimeBucketQueryText).
+		Return(&pgconn.StatementDescription{ParamOIDs: []uint32{25, 1114, 1114}}, nil).
+		Times(workerCount)
+	conn.EXPECT().
+		Exec(gomock.Any(), db.TimeBucketQueryName, gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(pgconn.CommandTag{}, nil).
+		Times(queryCount + 250)
+	conn.EXPECT().
+		Close(gomock.Any()).
+		Return(nil).
+		Times(workerCount)
+
+	// Warmup cycles over the input, the measured phase restarts from the beginning
+	cmd := &BenchmarkCommand{
+		LatencyPrecision: 3,
+		Input:            inputFile,
+		Concurrency:      workerCount,
+		Warmup:           "250",
+	}
+	stats, err := cmd.runBench(context.Background(), connectTo(conn))
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, stats.BenchPasses)
+	assert.EqualValues(t, queryCount, stats.QueriesOk)
+	require.NotNil(t, stats.Warmup)
+	assert.EqualValues(t, 250, stats.Warmup.QueriesOk)
+
+	var total uint64
+	for _, v := range stats.QueriesPerWorker {
+		total += v
+	}
+	assert.EqualValues(t, queryCount, total)
+}
+
+func TestRunBenchmark_Rate(t *testing.T) {
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+	conn.EXPECT().
+		Prepare(gomock.Any(), db.TimeBucketQueryName, db.TimeBucketQueryText).
+		Return(&pgconn.StatementDescription{ParamOIDs: []uint32{25, 1114, 1114}}, nil).
+		Times(workerCount)
+	conn.EXPECT().
+		Exec(gomock.Any(), db.TimeBucketQueryName, gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(pgconn.CommandTag{}, nil).
+		Times(queryCount)
+	conn.EXPECT().
+		Close(gomock.Any()).
+		Return(nil).
+		Times(workerCount)
+
+	cmd := &BenchmarkCommand{
+		LatencyPrecision: 3,
+		Input:            inputFile,
+		Concurrency:      workerCount,
+		Rate:             "2000/s",
+	}
+	start := time.Now()
+	stats, err := cmd.runBench(context.Background(), connectTo(conn))
+	require.NoError(t, err)
+
+	// 200 queries at 2000/s should take about 100ms
+	assert.GreaterOrEqual(t, time.Since(start), 99*time.Millisecond)
+	assert.EqualValues(t, queryCount, stats.QueriesOk)
+	require.NotNil(t, stats.Schedule)
+	assert.EqualValues(t, 2000, stats.Schedule.Rate)
+	require.NotNil(t, stats.Corrected)
+	assert.GreaterOrEqual(t, stats.Corrected.Min, stats.Min)
+}
+
+func TestRunBenchmark_Stages(t *testing.T) {
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+
+	// Workers 0-3 are spawned for the first stage, worker 1 is retired then spawned again
+	conn.EXPECT().
+		Prepare(gomock.Any(), db.TimeBucketQueryName, db.TimeBucketQueryText).
+		Return(&pgconn.StatementDescription{ParamOIDs: []uint32{25, 1114, 1114}}, nil).
+		Times(5)
+	conn.EXPECT().
+		Exec(gomock.Any(), db.TimeBucketQueryName, gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, _ ...interface{}) (pgconn.CommandTag, error) {
+			time.Sleep(100 * time.Microsecond)
+			return pgconn.CommandTag{}, nil
+		}).
+		AnyTimes()
+	conn.EXPECT().
+		Close(gomock.Any()).
+		Return(nil).
+		Times(5)
+
+	cmd := &BenchmarkCommand{
+		LatencyPrecision: 3,
+		Input:            inputFile,
+		Concurrency:      16,
+		Stages:           "4:50ms,1:50ms,2:50ms",
+	}
+	stats, err := cmd.runBench(context.Background(), connectTo(conn))
+	require.NoError(t, err)
+	assert.EqualValues(t, 4, stats.BenchConcurrency)
+	require.Len(t, stats.QueriesPerWorker, 4)
+
+	require.Len(t, stats.Stages, 3)
+	var total uint64
+	for i, concurrency := range []uint32{4, 1, 2} {
+		s := stats.Stages[i]
+		assert.Equal(t, concurrency, s.Concurrency)
+		assert.GreaterOrEqual(t, s.Duration, 50.)
+		assert.Greater(t, s.Throughput, 0.)
+		assert.Greater(t, s.QueriesOk, uint64(0))
+		total += s.QueriesOk
+	}
+	assert.Equal(t, stats.QueriesOk, total)
+}
+
+// TestRunBenchmark_Routing checks that the routing strategies spread the 10 hostnames of the input across 16 workers.
+func TestRunBenchmark_Routing(t *testing.T) {
+	for _, routing := range []string{"round-robin", "shared-queue", "least-loaded", "consistent-hash"} {
+		t.Run(routing, func(t *testing.T) {
+			c := gomock.NewController(t)
+			conn := mock.NewMockConn(c)
+			conn.EXPECT().
+				Prepare(gomock.Any(), db.TimeBucketQueryName, db.TimeBucketQueryText).
+				Return(&pgconn.StatementDescription{ParamOIDs: []uint32{25, 1114, 1114}}, nil).
+				Times(16)
+			conn.EXPECT().
+				Exec(gomock.Any(), db.TimeBucketQueryName, gomock.Any(), gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ context.Context, _ string, _ ...interface{}) (pgconn.CommandTag, error) {
+					time.Sleep(time.Millisecond)
+					return pgconn.CommandTag{}, nil
+				}).
+				Times(queryCount)
+			conn.EXPECT().
+				Close(gomock.Any()).
+				Return(nil).
+				Times(16)
+
+			cmd := &BenchmarkCommand{
+				LatencyPrecision: 3,
+				Input:            inputFile,
+				Concurrency:      16,
+				Routing:          routing,
+				RoutingKey:       "start_time",
+			}
+			stats, err := cmd.runBench(context.Background(), connectTo(conn))
+			require.NoError(t, err)
+			assert.EqualValues(t, queryCount, stats.QueriesOk)
+			for i, v := range stats.QueriesPerWorker {
+				assert.Greater(t, v, uint64(0), "worker %d is idle", i)
+			}
+		})
+	}
+}
+
+func TestRunBenchmark_SharedQueueStages(t *testing.T) {
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+	conn.EXPECT().
+		Prepare(gomock.Any(), db.TimeBucketQueryName, db.TimeBucketQueryText).
+		Return(&pgconn.StatementDescription{ParamOIDs: []uint32{25, 1114, 1114}}, nil).
+		Times(5)
+	conn.EXPECT().
+		Exec(gomock.Any(), db.TimeBucketQueryName, gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, _ ...interface{}) (pgconn.CommandTag, error) {
+			time.Sleep(100 * time.Microsecond)
+			return pgconn.CommandTag{}, nil
+		}).
+		AnyTimes()
+	conn.EXPECT().
+		Close(gomock.Any()).
+		Return(nil).
+		Times(5)
+
+	cmd := &BenchmarkCommand{
+		LatencyPrecision: 3,
+		Input:            inputFile,
+		Stages:           "4:30ms,1:30ms,2:30ms",
+		Routing:          "shared-queue",
+	}
+	stats, err := cmd.runBench(context.Background(), connectTo(conn))
+	require.NoError(t, err)
+	require.Len(t, stats.Stages, 3)
+	assert.Greater(t, stats.QueriesOk, uint64(0))
+}
+
+func TestRunBenchmark_ReportInterval(t *testing.T) {
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+
+	conn.EXPECT().
+		Prepare(gomock.Any(), db.TimeBucketQueryName, db.TimeBucketQueryText).
+		Return(&pgconn.StatementDescription{ParamOIDs: []uint32{25, 1114, 1114}}, nil).
+		Times(workerCount)
+	conn.EXPECT().
+		Exec(gomock.Any(), db.TimeBucketQueryName, gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, _ ...interface{}) (pgconn.CommandTag, error) {
+			time.Sleep(100 * time.Microsecond)
+			return pgconn.CommandTag{}, nil
+		}).
+		AnyTimes()
+	conn.EXPECT().
+		Close(gomock.Any()).
+		Return(nil).
+		Times(workerCount)
+
+	reportFile := filepath.Join(t.TempDir(), "intervals.log")
+	cmd := &BenchmarkCommand{
+		LatencyPrecision: 3,
+		Input:            inputFile,
+		Concurrency:      workerCount,
+		Duration:         100 * time.Millisecond,
+		ReportInterval:   20 * time.Millisecond,
+		ReportFile:       reportFile,
+	}
+	stats, err := cmd.runBench(context.Background(), connectTo(conn))
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, len(stats.Intervals), 4)
+
+	var total uint64
+	for _, i := range stats.Intervals {
+		total += i.QueriesOk
+	}
+	assert.EqualValues(t, stats.QueriesOk, total)
+
+	lines, err := os.ReadFile(reportFile)
+	require.NoError(t, err)
+	assert.Len(t, strings.Split(strings.TrimSpace(string(lines)), "\n"), len(stats.Intervals))
+
+	// The report file is only written to in interval mode
+	cmd.ReportInterval = 0
+	_, err = cmd.runBench(context.Background(), nil)
+	assert.EqualError(t, err, "--report-file cannot be used without --report-interval")
+}
+
+func TestRunBenchmark_Interrupted(t *testing.T) {
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+	ctx, cancel := context.WithCancel(context.Background())
+	execCount := uint64(0)
+
+	conn.EXPECT().
+		Prepare(gomock.Any(), db.TimeBucketQueryName, db.TimeBucketQueryText).
+		Return(&pgconn.StatementDescription{ParamOIDs: []uint32{25, 1114, 1114}}, nil).
+		Times(workerCount)
+	conn.EXPECT().
+		Exec(gomock.Any(), db.TimeBucketQueryName, gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, _ string, _ ...interface{}) (pgconn.CommandTag, error) {
+			// Interrupt the benchmark halfway through the input
+			if atomic.AddUint64(&execCount, 1) == queryCount/2 {
+				cancel()
+			}
+			time.Sleep(100 * time.Microsecond)
+			return pgconn.CommandTag{}, ctx.Err()
+		}).
+		MaxTimes(queryCount)
+	conn.EXPECT().
+		Close(gomock.Any()).
+		Return(nil).
+		Times(workerCount)
+
+	cmd := &BenchmarkCommand{
+		LatencyPrecision: 3,
+		Input:            inputFile,
+		Concurrency:      workerCount,
+		Repeat:           10,
+	}
+	stats, err := cmd.runBench(ctx, connectTo(conn))
+	require.NoError(t, err)
+	assert.True(t, stats.Interrupted)
+	assert.Less(t, stats.BenchPasses, uint64(cmd.Repeat))
+	assert.Zero(t, stats.QueriesErr, "interrupted queries must not be reported as failed")
+	assert.Greater(t, stats.QueriesOk, uint64(0))
+	assert.Less(t, stats.QueriesOk, uint64(queryCount))
+}
+
+func TestRunBenchmark_Percentiles(t *testing.T) {
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+
+	conn.EXPECT().
+		Prepare(gomock.Any(), db.TimeBucketQueryName, db.TimeBucketQueryText).
+		Return(&pgconn.StatementDescription{ParamOIDs: []uint32{25, 1114, 1114}}, nil).
+		Times(1)
+	conn.EXPECT().
+		Exec(gomock.Any(), db.TimeBucketQueryName, gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(pgconn.CommandTag{}, nil).
+		Times(queryCount)
+	conn.EXPECT().
+		Close(gomock.Any()).
+		Return(nil).
+		Times(1)
+
+	cmd := &BenchmarkCommand{
+		Input:            inputFile,
+		Concurrency:      1,
+		Percentiles:      []float64{50, 99.9},
+		LatencyPrecision: 2,
+	}
+	stats, err := cmd.runBench(context.Background(), connectTo(conn))
+	require.NoError(t, err)
+	require.Len(t, stats.Percentiles, 2)
+	assert.Equal(t, 99.9, stats.Percentiles[1].Percentile)
+	assert.LessOrEqual(t, stats.Percentiles[1].Latency, stats.Max)
+	require.NotNil(t, stats.Histogram)
+	assert.EqualValues(t, queryCount, stats.Histogram.Count())
+}
+
+func TestRunBenchmark_InvalidPercentiles(t *testing.T) {
+	cmd := &BenchmarkCommand{
+		LatencyPrecision: 3,
+		Input:            inputFile,
+		Concurrency:      1,
+		Percentiles:      []float64{50, 120},
+	}
+	_, err := cmd.runBench(context.Background(), nil)
+	assert.EqualError(t, err, "invalid percentile 120, expected a value between 0 and 100")
+
+	cmd = &BenchmarkCommand{
+		Input:            inputFile,
+		Concurrency:      1,
+		LatencyPrecision: 6,
+	}
+	_, err = cmd.runBench(context.Background(), nil)
+	assert.EqualError(t, err, "latency precision must be between 1 and 5 significant digits")
+
+	// Flags are checked before opening the input
+	cmd = &BenchmarkCommand{
+		Input:       "testdata/missing.csv",
+		Concurrency: 1,
+	}
+	_, err = cmd.runBench(context.Background(), nil)
+	assert.EqualError(t, err, "latency precision must be between 1 and 5 significant digits")
+}
+
+func TestRunBenchmark_MaxErrors(t *testing.T) {
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+
+	conn.EXPECT().
+		Prepare(gomock.Any(), db.TimeBucketQueryName, db.TimeBucketQueryText).
+		Return(&pgconn.StatementDescription{ParamOIDs: []uint32{25, 1114, 1114}}, nil).
+		Times(workerCount)
+	conn.EXPECT().
+		Exec(gomock.Any(), db.TimeBucketQueryName, gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, _ string, _ ...interface{}) (pgconn.CommandTag, error) {
+			time.Sleep(100 * time.Microsecond)
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("always failing")
+		}).
+		MaxTimes(queryCount)
+	conn.EXPECT().
+		IsClosed().
+		Return(false).
+		AnyTimes()
+	conn.EXPECT().
+		Close(gomock.Any()).
+		Return(nil).
+		Times(workerCount)
+
+	cmd := &BenchmarkCommand{
+		LatencyPrecision: 3,
+		Input:            inputFile,
+		Concurrency:      workerCount,
+		Repeat:           10,
+		MaxErrors:        10,
+	}
+	stats, err := cmd.runBench(context.Background(), connectTo(conn))
+	require.NoError(t, err)
+	assert.False(t, stats.Interrupted)
+	assert.Contains(t, stats.Aborted, "more than the maximum of 10")
+	assert.Greater(t, stats.QueriesErr, uint64(10))
+	assert.Less(t, stats.QueriesErr, uint64(queryCount))
+}
+
+func TestRunBenchmark_Pool(t *testing.T) {
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+
+	conn.EXPECT().
+		Prepare(gomock.Any(), db.TimeBucketQueryName, db.TimeBucketQueryText).
+		Return(&pgconn.StatementDescription{ParamOIDs: []uint32{25, 1114, 1114}}, nil).
+		Times(queryCount)
+	conn.EXPECT().
+		Exec(gomock.Any(), db.TimeBucketQueryName, gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(nil, nil).
+		Times(queryCount)
+
+	// Eight clients share a pool of two connections
+	var acquired, released int64
+	slots := make(chan struct{}, 2)
+	acquire := func(ctx context.Context) (db.Conn, func(), error) {
+		slots <- struct{}{}
+		atomic.AddInt64(&acquired, 1)
+		return conn, func() {
+			atomic.AddInt64(&released, 1)
+			<-slots
+		}, nil
+	}
+	cmd := &BenchmarkCommand{
+		LatencyPrecision: 3,
+		Input:            inputFile,
+		Clients:          8,
+		PoolSize:         2,
+	}
+	stats, err := cmd.runBench(context.Background(), []target{{acquire: acquire}})
+	require.NoError(t, err)
+	assert.EqualValues(t, queryCount, stats.QueriesOk)
+	assert.Len(t, stats.QueriesPerWorker, 8)
+	assert.EqualValues(t, 2, stats.PoolSize)
+	assert.EqualValues(t, queryCount, acquired)
+	assert.EqualValues(t, queryCount, released)
+}
+
+func TestRunBenchmark_InvalidPool(t *testing.T) {
+	cmd := &BenchmarkCommand{
+		LatencyPrecision: 3,
+		Input:            inputFile,
+		Clients:          8,
+	}
+	_, err := cmd.runBench(context.Background(), connectTo(nil))
+	assert.EqualError(t, err, "--clients and --pool-size must be set together")
+}
+
+func TestRun_InvalidPool(t *testing.T) {
+	// Flags are validated before connecting to the database and opening the pool
+	cmd := &BenchmarkCommand{
+		LatencyPrecision: 3,
+		Input:            inputFile,
+		Concurrency:      workerCount,
+		Clients:          8,
+		DatabaseUrl:      []string{"postgres://localhost:1/homework"},
+		DatabaseWait:     time.Millisecond,
+	}
+	assert.EqualError(t, cmd.Run(&kong.Context{}), "--clients and --pool-size must be set together")
+}
+
+func TestRunBenchmark_Targets(t *testing.T) {
+	for _, policy := range []string{TargetRoundRobin, TargetWeighted, TargetHash} {
+		t.Run(policy, func(t *testing.T) {
+			c := gomock.NewController(t)
+			var targets []target
+			var executed [2]int64
+			for i := range executed {
+				i := i
+				conn := mock.NewMockConn(c)
+				conn.EXPECT().
+					Prepare(gomock.Any(), db.TimeBucketQueryName, db.TimeBucketQueryText).
+					Return(&pgconn.StatementDescription{ParamOIDs: []uint32{25, 1114, 1114}}, nil).
+					AnyTimes()
+				conn.EXPECT().
+					Exec(gomock.Any(), db.TimeBucketQueryName, gomock.Any(), gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, _ string, _ ...interface{}) (pgconn.CommandTag, error) {
+						atomic.AddInt64(&executed[i], 1)
+						return pgconn.CommandTag{}, nil
+					}).
+					AnyTimes()
+				conn.EXPECT().
+					Close(gomock.Any()).
+					Return(nil).
+					AnyTimes()
+				targets = append(targets, target{name: fmt.Sprintf("replica-%d:5432/tsdb", i), connect: connectTo(conn)[0].connect})
+			}
+
+			cmd := &BenchmarkCommand{
+				LatencyPrecision: 3,
+				Input:            inputFile,
+				Concurrency:      4,
+				Routing:          "round-robin",
+				TargetPolicy:     policy,
+			}
+			if policy == TargetWeighted {
+				cmd.TargetWeights = []int{3, 1}
+			}
+			stats, err := cmd.runBench(context.Background(), targets)
+			require.NoError(t, err)
+			assert.EqualValues(t, queryCount, stats.QueriesOk)
+			require.Len(t, stats.Targets, 2)
+			for i, s := range stats.Targets {
+				assert.Equal(t, fmt.Sprintf("replica-%d:5432/tsdb", i), s.Name)
+				assert.EqualValues(t, executed[i], s.QueriesOk)
+			}
+			if policy == TargetWeighted {
+				// Three workers on the first target, one on the second
+				assert.EqualValues(t, 3*queryCount/4, stats.Targets[0].QueriesOk)
+			} else {
+				assert.Greater(t, stats.Targets[1].QueriesOk, uint64(0))
+			}
+		})
+	}
+}
+
+func TestRunBenchmark_InvalidTargets(t *testing.T) {
+	targets := append(connectTo(nil), connectTo(nil)...)
+	cmd := &BenchmarkCommand{
+		LatencyPrecision: 3,
+		Input:            inputFile,
+		Concurrency:      1,
+		TargetPolicy:     TargetHash,
+	}
+	_, err := cmd.runBench(context.Background(), targets)
+	assert.EqualError(t, err, "--target-policy=hash needs at least one worker per database, got 1 workers for 2 databases")
+
+	cmd.TargetPolicy = TargetWeighted
+	_, err = cmd.runBench(context.Background(), targets)
+	assert.EqualError(t, err, "expected 2 target weights, got 0")
+}
+
+func TestRunBenchmark_Breakdown(t *testing.T) {
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+	conn.EXPECT().
+		Prepare(gomock.Any(), db.TimeBucketQueryName, db.TimeBucketQueryText).
+		Return(&pgconn.StatementDescription{ParamOIDs: []uint32{25, 1114, 1114}}, nil).
+		Times(workerCount)
+	conn.EXPECT().
+		Exec(gomock.Any(), db.TimeBucketQueryName, gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(pgconn.CommandTag{}, nil).
+		Times(queryCount)
+	conn.EXPECT().
+		Close(gomock.Any()).
+		Return(nil).
+		Times(workerCount)
+
+	cmd := &BenchmarkCommand{
+		LatencyPrecision: 3,
+		Input:            inputFile,
+		Concurrency:      workerCount,
+		Breakdown:        []string{"worker", "key"},
+		TopKeys:          3,
+	}
+	stats, err := cmd.runBench(context.Background(), connectTo(conn))
+	require.NoError(t, err)
+	require.Len(t, stats.Workers, workerCount)
+	for i, w := range stats.Workers {
+		assert.Equal(t, stats.QueriesPerWorker[i], w.QueriesOk)
+	}
+	var keyQueries uint64
+	for _, k := range stats.Keys {
+		assert.True(t, strings.HasPrefix(k.Key, "host_"), k.Key)
+		keyQueries += k.QueriesOk
+	}
+	assert.EqualValues(t, queryCount, keyQueries)
+	assert.Len(t, stats.SlowestKeys, 3)
+
+	cmd.Breakdown = []string{"statement"}
+	_, err = cmd.runBench(context.Background(), nil)
+	assert.EqualError(t, err, "unknown breakdown statement, expected worker or key")
+}
+
+func TestRunBenchmark_SampleExplain(t *testing.T) {
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+	conn.EXPECT().
+		Prepare(gomock.Any(), db.TimeBucketQueryName, db.TimeBucketQueryText).
+		Return(&pgconn.StatementDescription{ParamOIDs: []uint32{25, 1114, 1114}}, nil).
+		Times(workerCount)
+	conn.EXPECT().
+		Exec(gomock.Any(), db.TimeBucketQueryName, gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(pgconn.CommandTag{}, nil).
+		Times(queryCount)
+	var explained int64
+	conn.EXPECT().
+		Query(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, sql string, _ ...interface{}) (pgx.Rows, error) {
+			assert.True(t, strings.HasPrefix(sql, "EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) SELECT"), sql)
+			atomic.AddInt64(&explained, 1)
+			return nil, fmt.Errorf("explain failed")
+		}).
+		MinTimes(1).
+		MaxTimes(queryCount)
+	conn.EXPECT().
+		IsClosed().
+		Return(false).
+		AnyTimes()
+	conn.EXPECT().
+		Close(gomock.Any()).
+		Return(nil).
+		Times(workerCount + 1)
+
+	cmd := &BenchmarkCommand{
+		LatencyPrecision: 3,
+		Input:            inputFile,
+		Concurrency:      workerCount,
+		SampleExplain:    "100%",
+	}
+	stats, err := cmd.runBench(context.Background(), connectTo(conn))
+	require.NoError(t, err)
+	assert.EqualValues(t, queryCount, stats.QueriesOk)
+	require.NotNil(t, stats.Explain)
+	assert.EqualValues(t, explained, stats.Explain.Failed)
+}
+
+func TestRunBenchmark_StatementStatsUnavailable(t *testing.T) {
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+	conn.EXPECT().
+		Prepare(gomock.Any(), db.TimeBucketQueryName, db.TimeBucketQueryText).
+		Return(&pgconn.StatementDescription{ParamOIDs: []uint32{25, 1114, 1114}}, nil).
+		Times(workerCount)
+	conn.EXPECT().
+		Exec(gomock.Any(), db.TimeBucketQueryName, gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(pgconn.CommandTag{}, nil).
+		Times(queryCount)
+	conn.EXPECT().
+		Query(gomock.Any(), gomock.Any()).
+		Return(nil, fmt.Errorf(`relation "pg_stat_statements" does not exist`))
+	// The side connection is closed once the extension is found missing
+	conn.EXPECT().
+		Close(gomock.Any()).
+		Return(nil).
+		Times(workerCount + 1)
+
+	cmd := &BenchmarkCommand{
+		LatencyPrecision: 3,
+		Input:            inputFile,
+		Concurrency:      workerCount,
+		StatementStats:   true,
+	}
+	stats, err := cmd.runBench(context.Background(), connectTo(conn))
+	require.NoError(t, err)
+	assert.EqualValues(t, queryCount, stats.QueriesOk)
+	assert.Nil(t, stats.ServerStatements)
+}
+
+func TestRunBenchmark_StatementStatsSimpleProtocol(t *testing.T) {
+	cmd := &BenchmarkCommand{
+		LatencyPrecision: 3,
+		Input:            inputFile,
+		Concurrency:      workerCount,
+		Protocol:         db.ProtocolSimple,
+		StatementStats:   true,
+	}
+	_, err := cmd.runBench(context.Background(), connectTo(nil))
+	assert.EqualError(t, err, "--statement-stats cannot be used with --protocol=simple")
+}
+
+func TestRunBenchmark_ReconnectFailure(t *testing.T) {
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+
+	conn.EXPECT().
+		Prepare(gomock.Any(), db.TimeBucketQueryName, db.TimeBucketQueryText).
+		Return(&pgconn.StatementDescription{ParamOIDs: []uint32{25, 1114, 1114}}, nil)
+	conn.EXPECT().
+		Exec(gomock.Any(), db.TimeBucketQueryName, gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(nil, nil).
+		Times(10)
+	conn.EXPECT().
+		Exec(gomock.Any(), db.TimeBucketQueryName, gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(nil, fmt.Errorf("unexpected EOF"))
+	conn.EXPECT().
+		IsClosed().
+		Return(true).
+		AnyTimes()
+	conn.EXPECT().
+		Close(gomock.Any()).
+		Return(nil).
+		AnyTimes()
+
+	// The database is lost after the first connection
+	connected := false
+	targets := []target{{connect: func(ctx context.Context) (db.Conn, error) {
+		if connected {
+			return nil, fmt.Errorf("connection refused")
+		}
+		connected = true
+		return conn, nil
+	}}}
+	cmd := &BenchmarkCommand{
+		LatencyPrecision: 3,
+		Input:            inputFile,
+		Concurrency:      1,
+		ReconnectTimeout: 50 * time.Millisecond,
+	}
+	// The queries run before the failure are still reported
+	stats, err := cmd.runBench(context.Background(), targets)
+	require.NoError(t, err)
+	assert.False(t, stats.Interrupted)
+	assert.Contains(t, stats.Aborted, "connection refused")
+	assert.EqualValues(t, 10, stats.QueriesOk)
+	assert.EqualValues(t, 1, stats.QueriesErr)
 }
@@ -0,0 +1,79 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/xvello/pgbench/internal/db"
+	"github.com/xvello/pgbench/internal/stats"
+)
+
+// databasePoller reads the database statistics at a regular interval on a side connection to the first database,
+// to correlate the latency spikes with checkpoints, lock waits or cache misses.
+type databasePoller struct {
+	samples stats.DatabaseSamples
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+func startDatabasePoller(ctx context.Context, connect db.ConnectFunc, interval time.Duration) *databasePoller {
+	ctx, cancel := context.WithCancel(ctx)
+	p := &databasePoller{cancel: cancel, done: make(chan struct{})}
+	go p.run(ctx, connect, interval)
+	return p
+}
+
+// run polls the statistics until the context is cancelled. Errors stop the polling but not the benchmark.
+func (p *databasePoller) run(ctx context.Context, connect db.ConnectFunc, interval time.Duration) {
+	defer close(p.done)
+	conn, err := connect(ctx)
+	if err != nil {
+		p.warn(ctx, err)
+		return
+	}
+	defer func() { _ = conn.Close(context.Background()) }()
+
+	version, err := db.ReadServerVersionNum(ctx, conn)
+	if err != nil {
+		p.warn(ctx, err)
+		return
+	}
+	start := time.Now()
+	last := start
+	before, err := db.ReadDatabaseCounters(ctx, conn, version)
+	if err != nil {
+		p.warn(ctx, err)
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			after, err := db.ReadDatabaseCounters(ctx, conn, version)
+			if err != nil {
+				p.warn(ctx, err)
+				return
+			}
+			p.samples = append(p.samples, stats.NewDatabaseSample(now.Sub(start), now.Sub(last), before, after))
+			before, last = after, now
+		}
+	}
+}
+
+func (p *databasePoller) warn(ctx context.Context, err error) {
+	if ctx.Err() == nil {
+		_, _ = fmt.Fprintf(os.Stderr, "database statistics not reported: %s\n", err)
+	}
+}
+
+// stop stops the polling, and returns the samples collected.
+func (p *databasePoller) stop() stats.DatabaseSamples {
+	p.cancel()
+	<-p.done
+	return p.samples
+}
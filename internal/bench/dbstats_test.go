@@ -0,0 +1,36 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/xvello/pgbench/internal/db"
+	"github.com/xvello/pgbench/internal/db/mock"
+)
+
+func TestDatabasePoller_Unavailable(t *testing.T) {
+	// The poller stops on errors, without failing the benchmark
+	p := startDatabasePoller(context.Background(), func(ctx context.Context) (db.Conn, error) {
+		return nil, fmt.Errorf("connection refused")
+	}, time.Millisecond)
+	<-p.done
+	assert.Nil(t, p.stop())
+
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+	conn.EXPECT().
+		Query(gomock.Any(), gomock.Any()).
+		Return(nil, fmt.Errorf("permission denied for view pg_stat_bgwriter"))
+	conn.EXPECT().
+		Close(gomock.Any()).
+		Return(nil)
+	p = startDatabasePoller(context.Background(), func(ctx context.Context) (db.Conn, error) {
+		return conn, nil
+	}, time.Millisecond)
+	<-p.done
+	assert.Nil(t, p.stop())
+}
@@ -0,0 +1,59 @@
+package bench
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/xvello/pgbench/internal/db"
+)
+
+// parseSample parses the --sample-explain flag, a percentage of the queries ("1%"), into a ratio.
+func parseSample(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	if err != nil || !strings.HasSuffix(value, "%") || percent <= 0 || percent > 100 {
+		return 0, fmt.Errorf("invalid explain sample %s, expected a percentage of the queries (1%%)", value)
+	}
+	return percent / 100, nil
+}
+
+// sampler picks the queries to run again with EXPLAIN ANALYZE. Sampled queries are dropped while the explain
+// connection is busy, for the sampling to never slow down the workers.
+type sampler struct {
+	ratio   float64
+	random  *rand.Rand
+	queue   chan *db.Query
+	stopped int32 // Set atomically once the explain connection has failed
+}
+
+func newSampler(ratio float64) *sampler {
+	return &sampler{
+		ratio:  ratio,
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+		queue:  make(chan *db.Query, workerChannelSize),
+	}
+}
+
+// sample sends a copy of the query to the explain connection if sampled. Warmup queries are not sampled.
+func (s *sampler) sample(q *db.Query) {
+	if q.Warmup || atomic.LoadInt32(&s.stopped) != 0 || s.random.Float64() >= s.ratio {
+		return
+	}
+	sampled := *q
+	sampled.Done = nil
+	select {
+	case s.queue <- &sampled:
+	default:
+	}
+}
+
+// stop stops sampling queries, as they would not be explained.
+func (s *sampler) stop() {
+	atomic.StoreInt32(&s.stopped, 1)
+}
@@ -0,0 +1,70 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xvello/pgbench/internal/db"
+	"github.com/xvello/pgbench/internal/stats"
+)
+
+func TestParseSample(t *testing.T) {
+	for value, expected := range map[string]float64{
+		"":     0,
+		"1%":   0.01,
+		"0.5%": 0.005,
+		"100%": 1,
+	} {
+		ratio, err := parseSample(value)
+		assert.NoError(t, err, value)
+		assert.InDelta(t, expected, ratio, 1e-9, value)
+	}
+	for _, value := range []string{"1", "0%", "101%", "one%"} {
+		_, err := parseSample(value)
+		assert.EqualError(t, err, "invalid explain sample "+value+", expected a percentage of the queries (1%)")
+	}
+}
+
+func TestSampler(t *testing.T) {
+	s := newSampler(0.5)
+	done := func() {}
+	for i := 0; i < 2*workerChannelSize; i++ {
+		s.sample(&db.Query{Key: "host_000001", Done: done})
+		s.sample(&db.Query{Key: "host_000002", Warmup: true})
+	}
+	// Roughly half of the queries are sampled, warmup ones are skipped
+	assert.Greater(t, len(s.queue), workerChannelSize/4)
+	assert.Less(t, len(s.queue), 2*workerChannelSize)
+	for len(s.queue) > 0 {
+		q := <-s.queue
+		assert.Equal(t, "host_000001", q.Key)
+		assert.Nil(t, q.Done)
+	}
+
+	// Samples are dropped while the queue is full
+	s = newSampler(1)
+	for i := 0; i < 2*workerChannelSize; i++ {
+		s.sample(&db.Query{})
+	}
+	assert.Len(t, s.queue, workerChannelSize)
+}
+
+func TestWorkers_ExplainFailure(t *testing.T) {
+	w := &workers{
+		ctx: context.Background(),
+		targets: []target{{connect: func(ctx context.Context) (db.Conn, error) {
+			return nil, fmt.Errorf("too many connections")
+		}}},
+		resultChan: make(chan stats.Result, 1),
+	}
+	s := newSampler(1)
+	w.explain(s)
+	w.group.Wait()
+
+	// Sampling stops without failing the benchmark
+	s.sample(&db.Query{Statement: "query"})
+	assert.Empty(t, s.queue)
+	assert.Empty(t, w.resultChan)
+}
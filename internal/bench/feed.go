@@ -0,0 +1,209 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xvello/pgbench/internal/db"
+	"github.com/xvello/pgbench/internal/stats"
+)
+
+// phase defines when to stop feeding queries to the workers. Zero values mean no limit.
+// Load stages also set the worker count, and their 1-based index.
+type phase struct {
+	warmup      bool
+	duration    time.Duration
+	queries     uint64
+	passes      uint64
+	concurrency uint32
+	stage       int
+}
+
+// parseWarmup parses the --warmup flag: a duration ("30s"), a query count ("500") or a number of passes ("2passes").
+func parseWarmup(value string) (*phase, error) {
+	p := &phase{warmup: true}
+	var err error
+	switch {
+	case strings.HasSuffix(value, "passes"):
+		p.passes, err = strconv.ParseUint(strings.TrimSuffix(value, "passes"), 10, 64)
+	case strings.HasSuffix(value, "pass"):
+		p.passes, err = strconv.ParseUint(strings.TrimSuffix(value, "pass"), 10, 64)
+	default:
+		if p.queries, err = strconv.ParseUint(value, 10, 64); err != nil {
+			p.duration, err = time.ParseDuration(value)
+		}
+	}
+	if err != nil || p.duration < 0 || (p.duration == 0 && p.queries == 0 && p.passes == 0) {
+		return nil, fmt.Errorf("invalid warmup %q, expected a positive duration, query count or number of passes", value)
+	}
+	return p, nil
+}
+
+// parseStages parses the --stages flag, a list of worker count and duration pairs ("4:1m,8:1m").
+func parseStages(value string) ([]*phase, error) {
+	parts := strings.Split(value, ",")
+	stages := make([]*phase, 0, len(parts))
+	for i, s := range parts {
+		parts := strings.SplitN(s, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid stage %q, expected workers:duration", s)
+		}
+		concurrency, err := strconv.ParseUint(parts[0], 10, 32)
+		if err != nil || concurrency < 1 {
+			return nil, fmt.Errorf("invalid stage %q, worker count must be at least 1", s)
+		}
+		duration, err := time.ParseDuration(parts[1])
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("invalid stage %q, duration must be positive", s)
+		}
+		stages = append(stages, &phase{
+			duration:    duration,
+			concurrency: uint32(concurrency),
+			stage:       i + 1,
+		})
+	}
+	return stages, nil
+}
+
+// measurePhases returns the measured phases: the load stages if set,
+// or a single phase defined by the --repeat and --duration flags.
+func (c *BenchmarkCommand) measurePhases(stages []*phase) []*phase {
+	if len(stages) > 0 {
+		return stages
+	}
+	p := &phase{
+		duration: c.Duration,
+		passes:   uint64(c.Repeat),
+	}
+	if p.passes == 0 && p.duration == 0 {
+		p.passes = 1
+	}
+	return []*phase{p}
+}
+
+// feeder routes the workload queries to the workers.
+type feeder struct {
+	ctx        context.Context // Stops feeding queries when cancelled
+	queries    *workload
+	workers    *workers
+	resultChan chan<- stats.Result
+	schedule   *schedule // Open-loop mode if set
+
+	passQueries uint64          // Queries read since the start of the current pass
+	passes      uint64          // Completed passes of the measured phases
+	elapsed     []time.Duration // Duration of each measured phase
+}
+
+// run feeds the queries, running the warmup phase first if set, then retires the workers.
+func (f *feeder) run(warmup *phase, measure []*phase) {
+	defer f.workers.closeAll()
+
+	if warmup != nil {
+		if f.schedule != nil {
+			f.schedule.reset()
+		}
+		if _, ok := f.feedPhase(warmup); !ok {
+			return
+		}
+		// Start the measured phase from the beginning of the input
+		if err := f.rewind(); err != nil {
+			f.resultChan <- stats.Result{Err: err}
+			return
+		}
+	}
+
+	if f.schedule != nil {
+		f.schedule.reset()
+	}
+	for _, p := range measure {
+		start := time.Now()
+		passes, ok := f.feedPhase(p)
+		f.passes += passes
+		f.elapsed = append(f.elapsed, time.Since(start))
+		if !ok {
+			return
+		}
+	}
+}
+
+// feedPhase routes queries to the workers until the end of the phase, rewinding the input at the end of each pass.
+// It returns the number of completed passes, and false if the input cannot be read further.
+func (f *feeder) feedPhase(p *phase) (uint64, bool) {
+	var passes, sent uint64
+	var deadline time.Time
+	if p.duration > 0 {
+		deadline = time.Now().Add(p.duration)
+	}
+	if p.concurrency > 0 {
+		f.workers.resize(int(p.concurrency))
+	}
+
+	for {
+		if f.ctx.Err() != nil {
+			return passes, false
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return passes, true
+		}
+		if p.queries > 0 && sent >= p.queries {
+			return passes, true
+		}
+		q, e := f.queries.Read()
+		if e == io.EOF {
+			passes++
+			// Stop early on empty inputs instead of cycling over them until the deadline
+			if f.passQueries == 0 {
+				return passes, false
+			}
+			if p.passes > 0 && passes >= p.passes {
+				return passes, true
+			}
+			if e = f.rewind(); e != nil {
+				f.resultChan <- stats.Result{Err: e, Warmup: p.warmup, Stage: p.stage}
+				return passes, false
+			}
+			continue
+		}
+		f.passQueries++
+		sent++
+		if e != nil { // Skip and report parsing errors
+			f.resultChan <- stats.Result{Err: e, Warmup: p.warmup, Stage: p.stage}
+			continue
+		}
+		q.Warmup = p.warmup
+		q.Stage = p.stage
+		if !f.send(q) {
+			return passes, false
+		}
+	}
+}
+
+// rewind restarts the input from the beginning for a new pass.
+func (f *feeder) rewind() error {
+	f.passQueries = 0
+	return f.queries.rewind()
+}
+
+// send routes a query to its worker. In open-loop mode, it waits for the query's intended start time
+// before picking the worker, for the routing to see the current load of the workers.
+// It returns false if the context was cancelled before the query could be sent.
+func (f *feeder) send(q *db.Query) bool {
+	if f.schedule != nil {
+		q.Scheduled = f.schedule.wait(f.ctx)
+	}
+	worker := f.workers.route(q)
+	q.Enqueued = time.Now()
+	select {
+	case <-f.ctx.Done():
+		return false
+	case worker <- q:
+	}
+	if f.schedule != nil {
+		f.schedule.done(q.Scheduled)
+	}
+	return true
+}
@@ -0,0 +1,60 @@
+package bench
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWarmup(t *testing.T) {
+	cases := map[string]*phase{
+		"30s":     {warmup: true, duration: 30 * time.Second},
+		"500":     {warmup: true, queries: 500},
+		"1pass":   {warmup: true, passes: 1},
+		"2passes": {warmup: true, passes: 2},
+	}
+	for value, expected := range cases {
+		p, err := parseWarmup(value)
+		assert.NoError(t, err, value)
+		assert.Equal(t, expected, p, value)
+	}
+
+	for _, value := range []string{"", "0", "0s", "-1s", "0passes", "twopasses", "1 minute"} {
+		_, err := parseWarmup(value)
+		assert.EqualError(t, err, `invalid warmup "`+value+`", expected a positive duration, query count or number of passes`)
+	}
+}
+
+func TestParseStages(t *testing.T) {
+	stages, err := parseStages("4:1m,8:30s")
+	assert.NoError(t, err)
+	assert.Equal(t, []*phase{
+		{concurrency: 4, duration: time.Minute, stage: 1},
+		{concurrency: 8, duration: 30 * time.Second, stage: 2},
+	}, stages)
+
+	cases := map[string]string{
+		"":        `invalid stage "", expected workers:duration`,
+		"4":       `invalid stage "4", expected workers:duration`,
+		"4:1m,":   `invalid stage "", expected workers:duration`,
+		"0:1m":    `invalid stage "0:1m", worker count must be at least 1`,
+		"four:1m": `invalid stage "four:1m", worker count must be at least 1`,
+		"4:0s":    `invalid stage "4:0s", duration must be positive`,
+		"4:1":     `invalid stage "4:1", duration must be positive`,
+	}
+	for value, expected := range cases {
+		_, err := parseStages(value)
+		assert.EqualError(t, err, expected, value)
+	}
+}
+
+func TestMeasurePhases(t *testing.T) {
+	assert.Equal(t, []*phase{{passes: 1}}, (&BenchmarkCommand{}).measurePhases(nil))
+	assert.Equal(t, []*phase{{passes: 3}}, (&BenchmarkCommand{Repeat: 3}).measurePhases(nil))
+	assert.Equal(t, []*phase{{duration: time.Minute}}, (&BenchmarkCommand{Duration: time.Minute}).measurePhases(nil))
+	assert.Equal(t, []*phase{{passes: 2, duration: time.Minute}}, (&BenchmarkCommand{Repeat: 2, Duration: time.Minute}).measurePhases(nil))
+
+	stages := []*phase{{concurrency: 2, duration: time.Second, stage: 1}}
+	assert.Equal(t, stages, (&BenchmarkCommand{Duration: time.Minute}).measurePhases(stages))
+}
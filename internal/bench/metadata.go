@@ -0,0 +1,163 @@
+package bench
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/xvello/pgbench/internal/db"
+	"github.com/xvello/pgbench/internal/stats"
+)
+
+// Version and Commit identify the build in the report. They are set at build time with
+// -ldflags "-X github.com/xvello/pgbench/internal/bench.Version=v1.0.0 -X github.com/xvello/pgbench/internal/bench.Commit=abc1234".
+var (
+	Version = "dev"
+	Commit  string
+)
+
+// metadataTimeout bounds the time spent reading the server information.
+const metadataTimeout = 10 * time.Second
+
+// passwordPattern matches the password of a key/value connection string, or of a URL query parameter.
+var passwordPattern = regexp.MustCompile(`(password\s*=\s*)('(?:[^'\\]|\\.)*'|[^\s&]+)`)
+
+// newMetadata returns the metadata of the run known before it starts: the build, flags, input and client host.
+// The input of a workload is its workload file, the files it references are checksummed as well.
+func (c *BenchmarkCommand) newMetadata(k *kong.Context) (*stats.Metadata, error) {
+	m := &stats.Metadata{
+		Version: buildVersion(),
+		Commit:  Commit,
+		Flags:   flagValues(k),
+		Input:   c.Input,
+		Client: stats.ClientInfo{
+			CPUs:       runtime.NumCPU(),
+			GOMAXPROCS: runtime.GOMAXPROCS(0),
+		},
+	}
+	m.Client.Hostname, _ = os.Hostname()
+	if c.Workload != "" {
+		m.Input = c.Workload
+	}
+	if m.Input != "-" {
+		var err error
+		if m.InputSHA256, err = checksum(m.Input); err != nil {
+			return nil, err
+		}
+	}
+	if c.Workload != "" {
+		var err error
+		if m.WorkloadFiles, err = workloadChecksums(c.Workload); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// workloadChecksums returns the checksums of the query and input files referenced by a workload, by path.
+func workloadChecksums(path string) (map[string]string, error) {
+	def, err := readWorkloadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	checksums := make(map[string]string)
+	for _, s := range def.Statements {
+		for _, p := range []string{s.QueryFile, s.Input} {
+			if p == "" || p == "-" || checksums[p] != "" {
+				continue
+			}
+			if checksums[p], err = checksum(p); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return checksums, nil
+}
+
+// buildVersion returns Version, or the module version if the tool was installed with go install.
+func buildVersion() string {
+	if Version != "dev" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return Version
+}
+
+// flagValues returns the value of the command-line flags by name, redacting the database passwords.
+func flagValues(k *kong.Context) map[string]string {
+	values := make(map[string]string)
+	for _, f := range k.Flags() {
+		if f.Name == "help" {
+			continue
+		}
+		value := k.FlagValue(f)
+		v := reflect.ValueOf(value)
+		if v.Kind() != reflect.Slice {
+			values[f.Name] = fmt.Sprint(value)
+			continue
+		}
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = fmt.Sprint(v.Index(i).Interface())
+			if f.Name == "database-url" {
+				items[i] = redactPassword(items[i])
+			}
+		}
+		values[f.Name] = strings.Join(items, ",")
+	}
+	return values
+}
+
+// redactPassword hides the password of a connection string, in URL or key/value format.
+func redactPassword(conn string) string {
+	if u, err := url.Parse(conn); err == nil && u.User != nil {
+		conn = u.Redacted()
+	}
+	return passwordPattern.ReplaceAllString(conn, "${1}xxxxx")
+}
+
+// checksum returns the hex-encoded SHA-256 of a file.
+func checksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("cannot checksum input file: %w", err)
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("cannot checksum input file: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// readServerInfo reads the versions and settings of the database on a side connection. It returns nil and prints
+// a warning if they cannot be read, as the benchmark can still run without them.
+func readServerInfo(ctx context.Context, connect db.ConnectFunc) *stats.ServerInfo {
+	ctx, cancel := context.WithTimeout(ctx, metadataTimeout)
+	defer cancel()
+	conn, err := connect(ctx)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "server metadata not reported: %s\n", err)
+		return nil
+	}
+	defer func() { _ = conn.Close(ctx) }()
+	info, err := db.ReadServerInfo(ctx, conn)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "server metadata not reported: %s\n", err)
+		return nil
+	}
+	return info
+}
@@ -0,0 +1,36 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/xvello/pgbench/internal/db"
+)
+
+// openPool opens the connection pool shared by the clients in pool mode, and returns the function
+// to acquire its connections. New connections are configured like the dedicated ones.
+func (c *BenchmarkCommand) openPool(ctx context.Context, connConfig *pgx.ConnConfig) (*pgxpool.Pool, db.AcquireFunc, error) {
+	config, err := pgxpool.ParseConfig("")
+	if err != nil {
+		return nil, nil, err
+	}
+	config.ConnConfig = connConfig
+	config.MaxConns = int32(c.PoolSize)
+	opts := c.dbOptions()
+	config.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+		return db.ConfigureSession(ctx, conn, opts)
+	}
+	pool, err := pgxpool.ConnectConfig(ctx, config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot create connection pool: %w", err)
+	}
+	return pool, func(ctx context.Context) (db.Conn, func(), error) {
+		conn, err := pool.Acquire(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		return conn.Conn(), conn.Release, nil
+	}, nil
+}
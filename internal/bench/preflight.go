@@ -0,0 +1,157 @@
+package bench
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/xvello/pgbench/internal/db"
+	"github.com/xvello/pgbench/internal/stats"
+)
+
+// Preflight modes, checking the benchmarked dataset before the run.
+const (
+	PreflightStrict = "strict"
+	PreflightWarn   = "warn"
+	PreflightOff    = "off"
+)
+
+const (
+	// preflightTimeout bounds the time spent inspecting the dataset.
+	preflightTimeout = 30 * time.Second
+	// inputTimeLayout is the layout of the start and end times in the default statement's input.
+	inputTimeLayout = "2006-01-02 15:04:05"
+)
+
+// inputRange holds the distinct hosts and the time ranges queried by the default statement's input. Skipped counts
+// the rows that cannot be checked, err is set if the input could not be read to the end.
+type inputRange struct {
+	hosts   []string
+	starts  []time.Time
+	ends    []time.Time
+	skipped int
+	err     error
+}
+
+// readInputRange reads the hostname, start_time and end_time columns of the input. Times are read as UTC,
+// and the queries with invalid times are left out of the ranges, as they fail regardless of the data. Malformed
+// rows are skipped, and reading stops at the first other error: they are reported as preflight warnings.
+func readInputRange(path string) (*inputRange, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open input file: %w", err)
+	}
+	defer file.Close()
+	parser, err := db.NewQueryParser(file)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &inputRange{}
+	seen := make(map[string]bool)
+	for {
+		q, err := parser.Read()
+		if errors.Is(err, io.EOF) {
+			return r, nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) || (err == nil && len(q.Params) != 3) {
+			r.skipped++
+			continue
+		}
+		if err != nil {
+			r.err = err
+			return r, nil
+		}
+		if !seen[q.Params[0]] {
+			seen[q.Params[0]] = true
+			r.hosts = append(r.hosts, q.Params[0])
+		}
+		start, startErr := time.Parse(inputTimeLayout, q.Params[1])
+		end, endErr := time.Parse(inputTimeLayout, q.Params[2])
+		if startErr == nil && endErr == nil {
+			r.starts = append(r.starts, start)
+			r.ends = append(r.ends, end)
+		}
+	}
+}
+
+// checkDataset records how much of the input overlaps the data, and returns the mismatches found, if any.
+func checkDataset(d *stats.Dataset, input *inputRange) []string {
+	if d.MinTime == nil {
+		return []string{fmt.Sprintf("%s is empty, queries would succeed without reading any data", d.Table)}
+	}
+	if input == nil {
+		return nil
+	}
+	d.InputQueries = len(input.starts)
+	for i, start := range input.starts {
+		if d.Overlaps(start, input.ends[i]) {
+			d.QueriesInRange++
+		}
+	}
+
+	var warnings []string
+	if input.skipped > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d input rows are not hostname, start_time and end_time columns and were not checked", input.skipped))
+	}
+	if input.err != nil {
+		warnings = append(warnings, fmt.Sprintf("the input was only checked up to a read error: %s", input.err))
+	}
+	if d.HostsFound < d.InputHosts {
+		warnings = append(warnings, fmt.Sprintf("%d of the %d input hosts are not in %s", d.InputHosts-d.HostsFound, d.InputHosts, d.Table))
+	}
+	if d.QueriesInRange < d.InputQueries {
+		warnings = append(warnings, fmt.Sprintf("%d of the %d input queries are outside of the %s time range", d.InputQueries-d.QueriesInRange, d.InputQueries, d.Table))
+	}
+	return warnings
+}
+
+// preflight inspects the hypertable queried by the default statement on a side connection to the first database,
+// and checks that the input's hosts and time ranges overlap its data. Mismatches are returned as an error with
+// --preflight=strict, and are printed as warnings otherwise. The input is only checked for the default statement
+// reading an input file, as stdin cannot be read twice.
+func (c *BenchmarkCommand) preflight(ctx context.Context, connect db.ConnectFunc) (*stats.Dataset, error) {
+	var input *inputRange
+	var inputErr error
+	if c.Query == "" && c.QueryFile == "" && c.Workload == "" && c.Input != "-" {
+		input, inputErr = readInputRange(c.Input)
+	}
+
+	dataset, err := inspectDataset(ctx, connect, input)
+	if err != nil {
+		return nil, err
+	}
+	dataset.Warnings = checkDataset(dataset, input)
+	if inputErr != nil {
+		dataset.Warnings = append(dataset.Warnings, fmt.Sprintf("input not checked: %s", inputErr))
+	}
+	if len(dataset.Warnings) > 0 && c.Preflight == PreflightStrict {
+		return nil, errors.New(strings.Join(dataset.Warnings, ", "))
+	}
+	for _, w := range dataset.Warnings {
+		_, _ = fmt.Fprintf(os.Stderr, "preflight warning: %s\n", w)
+	}
+	return dataset, nil
+}
+
+// inspectDataset reads the fingerprint of the hypertable, looking up the input hosts if any.
+func inspectDataset(ctx context.Context, connect db.ConnectFunc, input *inputRange) (*stats.Dataset, error) {
+	ctx, cancel := context.WithTimeout(ctx, preflightTimeout)
+	defer cancel()
+	conn, err := connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close(ctx) }()
+	var hosts []string
+	if input != nil {
+		hosts = input.hosts
+	}
+	return db.InspectDataset(ctx, conn, hosts)
+}
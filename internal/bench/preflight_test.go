@@ -0,0 +1,105 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xvello/pgbench/internal/db"
+	"github.com/xvello/pgbench/internal/db/mock"
+	"github.com/xvello/pgbench/internal/stats"
+)
+
+func TestReadInputRange(t *testing.T) {
+	input, err := readInputRange(inputFile)
+	require.NoError(t, err)
+	assert.Len(t, input.hosts, 10)
+	assert.Equal(t, "host_000008", input.hosts[0])
+	assert.Len(t, input.starts, queryCount)
+	assert.Len(t, input.ends, queryCount)
+	assert.Equal(t, time.Date(2017, 1, 1, 8, 59, 22, 0, time.UTC), input.starts[0])
+	assert.Equal(t, time.Date(2017, 1, 1, 9, 59, 22, 0, time.UTC), input.ends[0])
+
+	// Rows with other columns are skipped, to be reported as warnings
+	input, err = readInputRange("testdata/hostnames.csv")
+	require.NoError(t, err)
+	assert.Empty(t, input.hosts)
+	assert.Equal(t, 10, input.skipped)
+
+	_, err = readInputRange("testdata/missing.csv")
+	assert.Error(t, err)
+}
+
+func TestReadInputRange_Malformed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input.csv")
+	require.NoError(t, os.WriteFile(path, []byte(`hostname,start_time,end_time
+host_000001,2017-01-01 08:59:22,2017-01-01 09:59:22
+host_000002,2017-01-01 "08:59:22",2017-01-01 09:59:22
+host_000003
+host_000004,2017-01-01 08:59:22,2017-01-01 09:59:22
+`), 0o600))
+	input, err := readInputRange(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"host_000001", "host_000004"}, input.hosts)
+	assert.Len(t, input.starts, 2)
+	assert.Equal(t, 2, input.skipped)
+	assert.NoError(t, input.err)
+}
+
+func TestCheckDataset(t *testing.T) {
+	min := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	max := time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC)
+	input := &inputRange{
+		hosts:  []string{"host_000001", "host_000002"},
+		starts: []time.Time{min.Add(time.Hour), max.Add(time.Hour)},
+		ends:   []time.Time{min.Add(2 * time.Hour), max.Add(2 * time.Hour)},
+	}
+
+	d := &stats.Dataset{Table: "cpu_usage", MinTime: &min, MaxTime: &max, InputHosts: 2, HostsFound: 2}
+	assert.Equal(t, []string{"1 of the 2 input queries are outside of the cpu_usage time range"}, checkDataset(d, input))
+	assert.Equal(t, 2, d.InputQueries)
+	assert.Equal(t, 1, d.QueriesInRange)
+
+	d = &stats.Dataset{Table: "cpu_usage", MinTime: &min, MaxTime: &max, InputHosts: 2, HostsFound: 1}
+	input.starts, input.ends = input.starts[:1], input.ends[:1]
+	assert.Equal(t, []string{"1 of the 2 input hosts are not in cpu_usage"}, checkDataset(d, input))
+
+	// Without input, only an empty dataset is reported
+	d = &stats.Dataset{Table: "cpu_usage", MinTime: &min, MaxTime: &max}
+	assert.Empty(t, checkDataset(d, nil))
+	// Unchecked rows and read errors are reported
+	d = &stats.Dataset{Table: "cpu_usage", MinTime: &min, MaxTime: &max, InputHosts: 2, HostsFound: 2}
+	input.skipped, input.err = 3, fmt.Errorf("read error")
+	assert.Equal(t, []string{
+		"3 input rows are not hostname, start_time and end_time columns and were not checked",
+		"the input was only checked up to a read error: read error",
+	}, checkDataset(d, input))
+
+	d = &stats.Dataset{Table: "cpu_usage"}
+	assert.Equal(t, []string{"cpu_usage is empty, queries would succeed without reading any data"}, checkDataset(d, input))
+}
+
+func TestPreflight(t *testing.T) {
+	unavailable := func(ctx context.Context) (db.Conn, error) {
+		c := gomock.NewController(t)
+		conn := mock.NewMockConn(c)
+		conn.EXPECT().
+			Query(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(nil, fmt.Errorf(`schema "timescaledb_information" does not exist`))
+		conn.EXPECT().
+			Close(gomock.Any()).
+			Return(nil)
+		return conn, nil
+	}
+
+	// The dataset cannot be inspected, the caller decides whether to run without the fingerprint
+	cmd := &BenchmarkCommand{Input: inputFile, Preflight: PreflightWarn}
+	_, err := cmd.preflight(context.Background(), unavailable)
+	assert.EqualError(t, err, `cannot inspect cpu_usage: schema "timescaledb_information" does not exist`)
+}
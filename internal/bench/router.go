@@ -0,0 +1,114 @@
+package bench
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/xvello/pgbench/internal/db"
+)
+
+// virtualNodes is the number of points of each worker on the consistent hash ring.
+const virtualNodes = 128
+
+// router picks the worker in charge of a query, among the active ones.
+type router interface {
+	route(q *db.Query, queues []*queue) int
+}
+
+// newRouter returns the router for a --routing strategy, defaulting to hash.
+// The shared-queue strategy needs no router.
+func newRouter(strategy string) (router, error) {
+	switch strategy {
+	case "", "hash":
+		return hashRouter{}, nil
+	case "round-robin":
+		return &roundRobinRouter{}, nil
+	case "least-loaded":
+		return leastLoadedRouter{}, nil
+	case "consistent-hash":
+		return &ringRouter{}, nil
+	default:
+		return nil, fmt.Errorf("unknown routing strategy %s", strategy)
+	}
+}
+
+// hashRouter sends all the queries with the same routing key to the same worker, to keep data locality.
+type hashRouter struct{}
+
+func (hashRouter) route(q *db.Query, queues []*queue) int {
+	return int(q.Hash() % uint64(len(queues)))
+}
+
+// roundRobinRouter spreads the queries evenly across workers, regardless of their routing key.
+type roundRobinRouter struct {
+	next int
+}
+
+func (r *roundRobinRouter) route(_ *db.Query, queues []*queue) int {
+	current := r.next % len(queues)
+	r.next = current + 1
+	return current
+}
+
+// leastLoadedRouter sends each query to the worker with the fewest queued or running queries.
+type leastLoadedRouter struct{}
+
+func (leastLoadedRouter) route(_ *db.Query, queues []*queue) int {
+	best := 0
+	bestLoad := queues[0].load()
+	for i, q := range queues[1:] {
+		if load := q.load(); load < bestLoad {
+			best, bestLoad = i+1, load
+		}
+	}
+	return best
+}
+
+// ringRouter keeps data locality like hashRouter, but uses virtual nodes to spread the routing keys evenly,
+// and only moves a fraction of the keys when workers are added or retired.
+type ringRouter struct {
+	workers int
+	points  []uint64
+	owners  map[uint64]int
+}
+
+func (r *ringRouter) route(q *db.Query, queues []*queue) int {
+	if r.workers != len(queues) {
+		r.build(len(queues))
+	}
+	hash := mix(q.Hash())
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= hash })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+// build places the virtual nodes of each worker on the ring.
+func (r *ringRouter) build(workers int) {
+	r.workers = workers
+	r.points = make([]uint64, 0, workers*virtualNodes)
+	r.owners = make(map[uint64]int, workers*virtualNodes)
+	for w := 0; w < workers; w++ {
+		for v := 0; v < virtualNodes; v++ {
+			point := mix(uint64(w)<<32 | uint64(v))
+			if _, found := r.owners[point]; found {
+				continue
+			}
+			r.owners[point] = w
+			r.points = append(r.points, point)
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+}
+
+// mix spreads the bits of a query hash, as FNV hashes of similar keys only differ in their lowest bits
+// and would end up next to each other on the ring. It uses the MurmurHash3 finalizer.
+func mix(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb3c2f2c3bd93
+	h ^= h >> 33
+	return h
+}
@@ -0,0 +1,99 @@
+package bench
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xvello/pgbench/internal/db"
+)
+
+func makeQueues(count int) []*queue {
+	queues := make([]*queue, count)
+	for i := range queues {
+		queues[i] = &queue{c: make(chan *db.Query, workerChannelSize)}
+	}
+	return queues
+}
+
+func TestNewRouter(t *testing.T) {
+	for _, strategy := range []string{"hash", "round-robin", "least-loaded", "consistent-hash"} {
+		r, err := newRouter(strategy)
+		assert.NoError(t, err, strategy)
+		assert.NotNil(t, r, strategy)
+	}
+	_, err := newRouter("shared-queue")
+	assert.EqualError(t, err, "unknown routing strategy shared-queue")
+}
+
+func TestRoundRobinRouter(t *testing.T) {
+	r := &roundRobinRouter{}
+	queues := makeQueues(3)
+	q := &db.Query{Key: "host_000001"}
+	var order []int
+	for i := 0; i < 6; i++ {
+		order = append(order, r.route(q, queues))
+	}
+	assert.Equal(t, []int{0, 1, 2, 0, 1, 2}, order)
+}
+
+func TestLeastLoadedRouter(t *testing.T) {
+	queues := makeQueues(3)
+	queues[0].pending = 2
+	queues[1].pending = 1
+	assert.Equal(t, 2, leastLoadedRouter{}.route(&db.Query{}, queues))
+	queues[2].pending = 1
+	assert.Equal(t, 1, leastLoadedRouter{}.route(&db.Query{}, queues))
+}
+
+func TestRingRouter(t *testing.T) {
+	r := &ringRouter{}
+	queues := makeQueues(16)
+
+	// Keys are consistently routed, and spread across all workers
+	keys := make(map[string]int)
+	counts := make([]int, len(queues))
+	for i := 0; i < 1600; i++ {
+		key := fmt.Sprintf("host_%06d", i)
+		worker := r.route(&db.Query{Key: key}, queues)
+		require.Equal(t, worker, r.route(&db.Query{Key: key}, queues))
+		keys[key] = worker
+		counts[worker]++
+	}
+	for i, count := range counts {
+		assert.Greater(t, count, 50, "worker %d is underused", i)
+		assert.Less(t, count, 200, "worker %d is overused", i)
+	}
+
+	// Adding a worker only moves the keys it now owns
+	queues = makeQueues(17)
+	var moved int
+	for key, previous := range keys {
+		worker := r.route(&db.Query{Key: key}, queues)
+		if worker != previous {
+			assert.Equal(t, 16, worker)
+			moved++
+		}
+	}
+	assert.Greater(t, moved, 0)
+	assert.Less(t, moved, 200)
+}
+
+func TestWorkers_RoutePending(t *testing.T) {
+	w := &workers{router: leastLoadedRouter{}, queues: makeQueues(2)}
+
+	// Worker 0 is running a query it already took off its channel, the next one goes to worker 1
+	running := &db.Query{}
+	w.route(running) <- running
+	assert.Equal(t, running, <-w.queues[0].c)
+	w.route(&db.Query{}) <- &db.Query{}
+	assert.Len(t, w.queues[1].c, 1)
+	assert.EqualValues(t, 1, w.queues[0].load())
+
+	// Once its result is reported, worker 0 is idle again
+	running.Done()
+	assert.EqualValues(t, 0, w.queues[0].load())
+	w.route(&db.Query{}) <- &db.Query{}
+	assert.Len(t, w.queues[0].c, 1)
+}
@@ -0,0 +1,109 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xvello/pgbench/internal/stats"
+)
+
+// rateUnits lists the accepted units for the --rate flag.
+var rateUnits = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+}
+
+// parseRate parses the --rate flag, a number of queries per unit of time ("500/s", "1200/m"),
+// and returns the interval between two queries. The unit defaults to seconds.
+func parseRate(value string) (time.Duration, error) {
+	count, unit := value, "s"
+	if i := strings.IndexByte(value, '/'); i >= 0 {
+		count, unit = value[:i], value[i+1:]
+	}
+	rate, err := strconv.ParseFloat(count, 64)
+	period, found := rateUnits[unit]
+	if err != nil || !found || rate <= 0 {
+		return 0, fmt.Errorf("invalid rate %q, expected a positive number of queries per s, m or h", value)
+	}
+	interval := time.Duration(float64(period) / rate)
+	if interval <= 0 {
+		return 0, fmt.Errorf("rate %q is too high", value)
+	}
+	return interval, nil
+}
+
+// schedule computes the intended start times of queries in open-loop mode, independently of their completion.
+// It keeps track of how far behind schedule the queries are dispatched.
+type schedule struct {
+	interval time.Duration
+	random   *rand.Rand // Poisson arrivals if set, fixed intervals otherwise
+	next     time.Time
+
+	dispatched uint64
+	lagSum     time.Duration
+	lagMax     time.Duration
+}
+
+func newSchedule(interval time.Duration, poisson bool) *schedule {
+	s := &schedule{interval: interval}
+	if poisson {
+		s.random = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return s
+}
+
+// reset restarts the timeline and the lag statistics, at the start of a phase.
+func (s *schedule) reset() {
+	s.next = time.Now()
+	s.dispatched = 0
+	s.lagSum = 0
+	s.lagMax = 0
+}
+
+// wait sleeps until the next intended start time and returns it.
+// It returns immediately if the dispatcher is behind schedule, or if the context is cancelled.
+func (s *schedule) wait(ctx context.Context) time.Time {
+	intended := s.next
+	if s.random != nil {
+		s.next = s.next.Add(time.Duration(s.random.ExpFloat64() * float64(s.interval)))
+	} else {
+		s.next = s.next.Add(s.interval)
+	}
+	if d := time.Until(intended); d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+		}
+	}
+	return intended
+}
+
+// done records the dispatch lag of a query after it is handed to a worker.
+func (s *schedule) done(intended time.Time) {
+	lag := time.Since(intended)
+	s.dispatched++
+	s.lagSum += lag
+	if lag > s.lagMax {
+		s.lagMax = lag
+	}
+}
+
+// summary returns the schedule parameters and dispatch lag statistics for the report.
+func (s *schedule) summary() *stats.Schedule {
+	summary := &stats.Schedule{
+		Rate:    float64(time.Second) / float64(s.interval),
+		Poisson: s.random != nil,
+		MaxLag:  float64(s.lagMax) / float64(time.Millisecond),
+	}
+	if s.dispatched > 0 {
+		summary.MeanLag = float64(s.lagSum) / float64(s.dispatched) / float64(time.Millisecond)
+	}
+	return summary
+}
@@ -0,0 +1,77 @@
+package bench
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRate(t *testing.T) {
+	cases := map[string]time.Duration{
+		"500":    2 * time.Millisecond,
+		"500/s":  2 * time.Millisecond,
+		"1200/m": 50 * time.Millisecond,
+		"0.5/s":  2 * time.Second,
+		"60/h":   time.Minute,
+	}
+	for value, expected := range cases {
+		interval, err := parseRate(value)
+		assert.NoError(t, err, value)
+		assert.Equal(t, expected, interval, value)
+	}
+
+	for _, value := range []string{"", "0/s", "-1/s", "10/d", "fast"} {
+		_, err := parseRate(value)
+		assert.EqualError(t, err, `invalid rate "`+value+`", expected a positive number of queries per s, m or h`)
+	}
+	_, err := parseRate("1e12/s")
+	assert.EqualError(t, err, `rate "1e12/s" is too high`)
+}
+
+func TestSchedule_Fixed(t *testing.T) {
+	s := newSchedule(5*time.Millisecond, false)
+	s.reset()
+	start := s.next
+
+	for i := 0; i < 4; i++ {
+		intended := s.wait(context.Background())
+		assert.Equal(t, start.Add(time.Duration(i)*5*time.Millisecond), intended)
+		assert.False(t, time.Now().Before(intended))
+		s.done(intended)
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 15*time.Millisecond)
+
+	// Falling behind schedule does not shift the timeline
+	time.Sleep(20 * time.Millisecond)
+	intended := s.wait(context.Background())
+	assert.Equal(t, start.Add(20*time.Millisecond), intended)
+	s.done(intended)
+
+	summary := s.summary()
+	assert.Equal(t, 200., summary.Rate)
+	assert.False(t, summary.Poisson)
+	assert.GreaterOrEqual(t, summary.MaxLag, 15.)
+	assert.Greater(t, summary.MeanLag, 0.)
+	assert.LessOrEqual(t, summary.MeanLag, summary.MaxLag)
+}
+
+func TestSchedule_Poisson(t *testing.T) {
+	s := newSchedule(time.Millisecond, true)
+	s.reset()
+	// Start the timeline in the past to avoid waiting
+	start := s.next.Add(-time.Hour)
+	s.next = start
+
+	var previous time.Time
+	for i := 0; i < 1000; i++ {
+		intended := s.wait(context.Background())
+		require.False(t, intended.Before(previous))
+		previous = intended
+	}
+	// The mean interval between arrivals should be close to the target
+	assert.InDelta(t, time.Second.Seconds(), s.next.Sub(start).Seconds(), 0.2)
+	assert.True(t, s.summary().Poisson)
+}
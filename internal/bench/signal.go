@@ -0,0 +1,42 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// interruptedExitCode is the exit status when a second signal aborts the benchmark, following the shell convention.
+const interruptedExitCode = 130
+
+// notifyInterrupt returns a context cancelled on the first SIGINT or SIGTERM, to stop the benchmark
+// and still print a partial report. A second signal exits immediately.
+func notifyInterrupt(parent context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(parent)
+	signals := make(chan os.Signal, 2)
+	done := make(chan struct{})
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case <-done:
+			return
+		case <-signals:
+		}
+		_, _ = fmt.Fprintf(os.Stderr, "Interrupted, stopping the benchmark. Interrupt again to exit immediately.\n")
+		cancel()
+		select {
+		case <-done:
+		case <-signals:
+			os.Exit(interruptedExitCode)
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		close(done)
+		cancel()
+	}
+}
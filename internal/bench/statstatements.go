@@ -0,0 +1,54 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/xvello/pgbench/internal/db"
+	"github.com/xvello/pgbench/internal/stats"
+)
+
+// snapshotTimeout bounds the time spent reading pg_stat_statements, also after an interrupted run.
+const snapshotTimeout = 10 * time.Second
+
+// statementSnapshot reads the pg_stat_statements counters of the benchmarked statements before and after the run,
+// on a side connection to the first database.
+type statementSnapshot struct {
+	conn       db.Conn
+	statements []*db.Statement
+	before     map[string]stats.StatementStats
+}
+
+// snapshotStatements reads the counters before the run. It returns nil and prints a warning if pg_stat_statements
+// is not available, as the benchmark can still run without it.
+func snapshotStatements(ctx context.Context, connect db.ConnectFunc, statements []*db.Statement) *statementSnapshot {
+	ctx, cancel := context.WithTimeout(ctx, snapshotTimeout)
+	defer cancel()
+	conn, err := connect(ctx)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "pg_stat_statements not reported: %s\n", err)
+		return nil
+	}
+	before, err := db.SnapshotStatements(ctx, conn, statements)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "pg_stat_statements not reported: %s\n", err)
+		_ = conn.Close(ctx)
+		return nil
+	}
+	return &statementSnapshot{conn: conn, statements: statements, before: before}
+}
+
+// deltas reads the counters after the run, and returns their increase. The side connection is closed.
+func (s *statementSnapshot) deltas() map[string]*stats.StatementStats {
+	ctx, cancel := context.WithTimeout(context.Background(), snapshotTimeout)
+	defer cancel()
+	defer func() { _ = s.conn.Close(ctx) }()
+	after, err := db.SnapshotStatements(ctx, s.conn, s.statements)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "pg_stat_statements not reported: %s\n", err)
+		return nil
+	}
+	return stats.StatementDeltas(s.before, after)
+}
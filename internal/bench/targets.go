@@ -0,0 +1,107 @@
+package bench
+
+import (
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/xvello/pgbench/internal/db"
+)
+
+// Target policies, spreading the workers across the benchmarked databases.
+const (
+	TargetRoundRobin = "round-robin"
+	TargetWeighted   = "weighted"
+	TargetHash       = "hash"
+)
+
+// target is one of the benchmarked databases, such as a primary or a read replica.
+type target struct {
+	name    string
+	connect db.ConnectFunc
+	acquire db.AcquireFunc // Acquires a connection from the target's pool in pool mode
+}
+
+// targetName identifies a database in the report by its host, port and database name.
+func targetName(config *pgx.ConnConfig) string {
+	return fmt.Sprintf("%s:%d/%s", config.Host, config.Port, config.Database)
+}
+
+// targetSlots returns the sequence of targets the workers are assigned to, worker i connecting to the target
+// in slot i modulo the sequence length. The round-robin and hash policies alternate between targets, the weighted
+// policy interleaves them in proportion of their weight, like nginx's smooth weighted round-robin.
+func targetSlots(policy string, weights []int, count int) ([]int, error) {
+	if policy != TargetWeighted {
+		if len(weights) > 0 {
+			return nil, fmt.Errorf("--target-weights can only be used with --target-policy=%s", TargetWeighted)
+		}
+		weights = make([]int, count)
+		for i := range weights {
+			weights[i] = 1
+		}
+	}
+	if len(weights) != count {
+		return nil, fmt.Errorf("expected %d target weights, got %d", count, len(weights))
+	}
+	total := 0
+	for _, w := range weights {
+		if w < 1 {
+			return nil, fmt.Errorf("invalid target weight %d, expected a positive integer", w)
+		}
+		total += w
+	}
+
+	slots := make([]int, total)
+	current := make([]int, count)
+	for i := range slots {
+		best := 0
+		for t, w := range weights {
+			current[t] += w
+			if current[t] > current[best] {
+				best = t
+			}
+		}
+		current[best] -= total
+		slots[i] = best
+	}
+	return slots, nil
+}
+
+// targetRouter sends all the queries with the same routing key to the same target, then picks one of the target's
+// workers with the routing strategy. Workers are assigned to targets in turn, worker i running on target i modulo
+// the target count.
+type targetRouter struct {
+	routers []router // Routes the queries across the workers of each target
+	subsets [][]*queue
+	last    *queue // Last worker when the subsets were built, to rebuild them after a resize
+}
+
+func newTargetRouter(strategy string, count int) (router, error) {
+	r := &targetRouter{routers: make([]router, count)}
+	for i := range r.routers {
+		var err error
+		if r.routers[i], err = newRouter(strategy); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (r *targetRouter) route(q *db.Query, queues []*queue) int {
+	count := len(r.routers)
+	if r.subsets == nil || r.last != queues[len(queues)-1] {
+		r.build(queues)
+	}
+	// Mixing the hash keeps the routing within the target independent of the target choice
+	t := int(mix(q.Hash()) % uint64(count))
+	return t + r.routers[t].route(q, r.subsets[t])*count
+}
+
+// build splits the active workers by target.
+func (r *targetRouter) build(queues []*queue) {
+	r.subsets = make([][]*queue, len(r.routers))
+	for i, q := range queues {
+		t := i % len(r.routers)
+		r.subsets[t] = append(r.subsets[t], q)
+	}
+	r.last = queues[len(queues)-1]
+}
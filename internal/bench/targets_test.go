@@ -0,0 +1,59 @@
+package bench
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xvello/pgbench/internal/db"
+)
+
+func TestTargetSlots(t *testing.T) {
+	slots, err := targetSlots(TargetRoundRobin, nil, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 1, 2}, slots)
+
+	slots, err = targetSlots(TargetWeighted, []int{3, 1}, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 0, 1, 0}, slots)
+
+	slots, err = targetSlots(TargetWeighted, []int{1, 2, 1}, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 0, 2, 1}, slots)
+
+	_, err = targetSlots(TargetWeighted, []int{1}, 2)
+	assert.EqualError(t, err, "expected 2 target weights, got 1")
+	_, err = targetSlots(TargetWeighted, []int{1, 0}, 2)
+	assert.EqualError(t, err, "invalid target weight 0, expected a positive integer")
+	_, err = targetSlots(TargetHash, []int{1, 2}, 2)
+	assert.EqualError(t, err, "--target-weights can only be used with --target-policy=weighted")
+}
+
+func TestTargetRouter(t *testing.T) {
+	r, err := newTargetRouter("round-robin", 2)
+	require.NoError(t, err)
+	queues := makeQueues(5)
+
+	// Queries of a routing key always run on the same target, spread across its workers
+	targets := make(map[string]int)
+	used := make(map[int]bool)
+	for pass := 0; pass < 3; pass++ {
+		for i := 0; i < 100; i++ {
+			key := fmt.Sprintf("host_%06d", i)
+			worker := r.route(&db.Query{Key: key}, queues)
+			if pass == 0 {
+				targets[key] = worker % 2
+			}
+			assert.Equal(t, targets[key], worker%2, key)
+			used[worker] = true
+		}
+	}
+	assert.Len(t, used, 5)
+
+	// Retiring workers keeps the keys on their target
+	queues = queues[:2]
+	for key, target := range targets {
+		assert.Equal(t, target, r.route(&db.Query{Key: key}, queues), key)
+	}
+}
@@ -0,0 +1 @@
+SELECT * FROM cpu_usage WHERE host = $1 ORDER BY ts DESC LIMIT 1;
@@ -0,0 +1,171 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/xvello/pgbench/internal/db"
+	"github.com/xvello/pgbench/internal/stats"
+)
+
+// workers runs the database workers, each with its own connection.
+// Workers can be added or retired between load stages.
+type workers struct {
+	ctx        context.Context
+	targets    []target // Databases to connect to, sharing a connection pool per target in pool mode
+	slots      []int    // Target of each worker, modulo the slot count
+	statements []*db.Statement
+	options    db.Options
+	resultChan chan stats.Result
+	router     router          // Picks the worker of each query, unless using a shared queue
+	shared     chan *db.Query  // Queue shared by all workers, if set
+	stop       []chan struct{} // Retires the worker from the shared queue
+	sampler    *sampler        // Samples the queries to explain, if set
+
+	queues []*queue // One queue per active worker
+	group  sync.WaitGroup
+	abort  context.CancelFunc // Stops the run on a worker error, by cancelling ctx
+	failed sync.Once
+	err    error // First worker error, read once the workers have returned
+}
+
+// queue holds the input channel of a worker, and the number of queries sent to it and not reported yet.
+type queue struct {
+	c       chan *db.Query
+	pending int64 // Updated atomically
+}
+
+// load returns the number of queries queued or running on the worker.
+func (q *queue) load() int64 {
+	return atomic.LoadInt64(&q.pending)
+}
+
+// resize spawns or retires workers to reach the given count.
+// Retired workers finish their pending queries before closing their connection.
+func (w *workers) resize(count int) {
+	for len(w.queues) < count {
+		i := len(w.queues)
+		var c chan *db.Query
+		if w.shared == nil {
+			c = make(chan *db.Query, workerChannelSize)
+		} else {
+			c = make(chan *db.Query)
+			stop := make(chan struct{})
+			w.stop = append(w.stop, stop)
+			go forward(w.ctx, w.shared, c, stop)
+		}
+		w.queues = append(w.queues, &queue{c: c})
+		opts := w.options
+		opts.Target = w.slots[i%len(w.slots)]
+		t := w.targets[opts.Target]
+		w.group.Add(1)
+		go func() {
+			defer w.group.Done()
+			var err error
+			if t.acquire != nil {
+				err = db.RunPooledQueries(w.ctx, i, t.acquire, w.statements, opts, c, w.resultChan)
+			} else {
+				err = db.RunQueries(w.ctx, i, t.connect, w.statements, opts, c, w.resultChan)
+			}
+			// Connection errors caused by an interruption or abort are expected, and not reported
+			if err != nil && w.ctx.Err() == nil {
+				w.fail(err)
+			}
+		}()
+	}
+	for len(w.queues) > count {
+		last := len(w.queues) - 1
+		if w.shared == nil {
+			close(w.queues[last].c)
+		} else {
+			close(w.stop[last])
+			w.stop = w.stop[:last]
+		}
+		w.queues = w.queues[:last]
+	}
+}
+
+// fail aborts the run after a worker error, such as a failed reconnection, keeping the first error for the report.
+// The results of the queries run so far are still reported.
+func (w *workers) fail(err error) {
+	w.failed.Do(func() {
+		w.err = err
+		_, _ = fmt.Fprintf(os.Stderr, "Aborting the benchmark: %s\n", err)
+		w.abort()
+	})
+}
+
+// route returns the channel to send the given query to, and counts it as pending on its worker until reported.
+func (w *workers) route(q *db.Query) chan<- *db.Query {
+	if w.sampler != nil {
+		w.sampler.sample(q)
+	}
+	if w.shared != nil {
+		return w.shared
+	}
+	target := w.queues[w.router.route(q, w.queues)]
+	atomic.AddInt64(&target.pending, 1)
+	q.Done = func() {
+		atomic.AddInt64(&target.pending, -1)
+	}
+	return target.c
+}
+
+// explain runs the queries picked by the sampler with EXPLAIN ANALYZE, on a side connection to the first database.
+// If the connection fails, sampling stops and the run continues.
+func (w *workers) explain(s *sampler) {
+	w.sampler = s
+	w.group.Add(1)
+	go func() {
+		defer w.group.Done()
+		// Sampling is optional, the benchmark goes on without it
+		err := db.RunExplains(w.ctx, w.targets[0].connect, w.statements, s.queue, w.resultChan)
+		if err != nil && w.ctx.Err() == nil {
+			_, _ = fmt.Fprintf(os.Stderr, "explain sampling stopped: %s\n", err)
+			s.stop()
+		}
+	}()
+}
+
+// closeAll retires all workers and the explain connection, then closes the results channel once they have all returned.
+func (w *workers) closeAll() {
+	if w.sampler != nil {
+		close(w.sampler.queue)
+	}
+	if w.shared != nil {
+		// Let the workers drain the shared queue before returning
+		close(w.shared)
+	} else {
+		w.resize(0)
+	}
+	go func() {
+		w.group.Wait()
+		close(w.resultChan)
+	}()
+}
+
+// forward hands the queries of the shared queue to a worker when it is ready to execute them,
+// until the queue is closed, the worker is retired or the context is cancelled.
+func forward(ctx context.Context, shared <-chan *db.Query, c chan<- *db.Query, stop <-chan struct{}) {
+	defer close(c)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		case q, ok := <-shared:
+			if !ok {
+				return
+			}
+			select {
+			case c <- q:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
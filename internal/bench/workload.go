@@ -0,0 +1,183 @@
+package bench
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/xvello/pgbench/internal/db"
+	"gopkg.in/yaml.v3"
+)
+
+// workloadFile is the format of the --workload definition file.
+// Relative paths are resolved from the directory holding the workload file.
+type workloadFile struct {
+	Statements []struct {
+		Name      string `yaml:"name"`
+		Query     string `yaml:"query"`
+		QueryFile string `yaml:"query_file"`
+		Input     string `yaml:"input"`
+		Weight    int    `yaml:"weight"`
+	} `yaml:"statements"`
+}
+
+// workloadSource feeds the queries of one statement.
+type workloadSource struct {
+	stmt    *db.Statement
+	queries *db.QueryParser
+	weight  int
+	current int
+}
+
+// workload interleaves the queries of its sources according to their weights,
+// using the smooth weighted round-robin algorithm to spread them evenly.
+// If routingKey is set, it names the input column used for worker routing.
+type workload struct {
+	routingKey  string
+	sources     []*workloadSource
+	totalWeight int
+}
+
+// readWorkloadFile parses a workload definition file, resolving the paths of its statements.
+func readWorkloadFile(path string) (*workloadFile, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read workload file: %w", err)
+	}
+	var def workloadFile
+	if err = yaml.Unmarshal(content, &def); err != nil {
+		return nil, fmt.Errorf("cannot parse workload file: %w", err)
+	}
+	if len(def.Statements) == 0 {
+		return nil, fmt.Errorf("workload file %s declares no statement", path)
+	}
+
+	dir := filepath.Dir(path)
+	resolve := func(p string) string {
+		if p == "" || p == "-" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(dir, p)
+	}
+	for i := range def.Statements {
+		def.Statements[i].QueryFile = resolve(def.Statements[i].QueryFile)
+		def.Statements[i].Input = resolve(def.Statements[i].Input)
+	}
+	return &def, nil
+}
+
+// load parses a workload definition file and opens the inputs of its statements.
+// If rewindable is set, inputs that cannot be rewound are buffered in memory.
+func (w *workload) load(path string, rewindable bool) error {
+	def, err := readWorkloadFile(path)
+	if err != nil {
+		return err
+	}
+
+	for i, s := range def.Statements {
+		if s.Name == "" {
+			return fmt.Errorf("statement %d has no name", i)
+		}
+		var stmt *db.Statement
+		switch {
+		case s.Query != "" && s.QueryFile != "":
+			return fmt.Errorf("statement %s: query and query_file can't be used together", s.Name)
+		case s.Query != "":
+			stmt = &db.Statement{Name: s.Name, Text: s.Query}
+		case s.QueryFile != "":
+			if stmt, err = db.LoadStatement(s.QueryFile); err != nil {
+				return err
+			}
+			stmt.Name = s.Name
+		default:
+			return fmt.Errorf("statement %s has no query", s.Name)
+		}
+		if s.Input == "" {
+			return fmt.Errorf("statement %s has no input", s.Name)
+		}
+		input, err := openInput(s.Input, rewindable)
+		if err != nil {
+			return err
+		}
+		weight := s.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		if err = w.add(stmt, input, weight); err != nil {
+			return fmt.Errorf("statement %s: %w", s.Name, err)
+		}
+	}
+	return nil
+}
+
+// add registers a statement and the input providing its parameters.
+func (w *workload) add(stmt *db.Statement, input io.Reader, weight int) error {
+	if weight < 1 {
+		return fmt.Errorf("weight must be at least 1")
+	}
+	for _, s := range w.sources {
+		if s.stmt.Name == stmt.Name {
+			return fmt.Errorf("duplicate statement name")
+		}
+	}
+	queries, err := db.NewQueryParser(input)
+	if err != nil {
+		return err
+	}
+	if w.routingKey != "" {
+		if err = queries.SetRoutingKey(w.routingKey); err != nil {
+			return err
+		}
+	}
+	w.sources = append(w.sources, &workloadSource{
+		stmt:    stmt,
+		queries: queries,
+		weight:  weight,
+	})
+	w.totalWeight += weight
+	return nil
+}
+
+// statements returns the statements to prepare on every connection.
+func (w *workload) statements() []*db.Statement {
+	statements := make([]*db.Statement, len(w.sources))
+	for i, s := range w.sources {
+		statements[i] = s.stmt
+	}
+	return statements
+}
+
+// Read returns the next query of the mix, or io.EOF as soon as one of the inputs is exhausted,
+// to keep the statement ratios accurate until the end of the benchmark.
+func (w *workload) Read() (*db.Query, error) {
+	var next *workloadSource
+	for _, s := range w.sources {
+		s.current += s.weight
+		if next == nil || s.current > next.current {
+			next = s
+		}
+	}
+	next.current -= w.totalWeight
+
+	q, err := next.queries.Read()
+	if err == io.EOF {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", next.stmt.Name, err)
+	}
+	q.Statement = next.stmt.Name
+	return q, nil
+}
+
+// rewind restarts all the inputs from their first query, to run another pass over the workload.
+func (w *workload) rewind() error {
+	for _, s := range w.sources {
+		if err := s.queries.Rewind(); err != nil {
+			return fmt.Errorf("%s: %w", s.stmt.Name, err)
+		}
+		s.current = 0
+	}
+	return nil
+}
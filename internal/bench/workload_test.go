@@ -0,0 +1,104 @@
+package bench
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xvello/pgbench/internal/db"
+)
+
+func TestLoadWorkload(t *testing.T) {
+	w := &workload{}
+	require.NoError(t, w.load("testdata/workload.yaml", false))
+
+	statements := w.statements()
+	require.Len(t, statements, 2)
+	assert.Equal(t, db.TimeBucketQueryName, statements[0].Name)
+	assert.Equal(t, db.TimeBucketQueryText+"\n", statements[0].Text)
+	assert.Equal(t, &db.Statement{
+		Name: "last-point",
+		Text: "SELECT * FROM cpu_usage WHERE host = $1 ORDER BY ts DESC LIMIT 1;\n",
+	}, statements[1])
+
+	// Weights are 3:1, the run stops when reading an 11th last-point query
+	counts := make(map[string]int)
+	for {
+		q, err := w.Read()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		counts[q.Statement]++
+	}
+	assert.Equal(t, map[string]int{db.TimeBucketQueryName: 32, "last-point": 10}, counts)
+}
+
+func TestLoadWorkload_Invalid(t *testing.T) {
+	cases := map[string]string{
+		"statements: []":                           "declares no statement",
+		"statements: [{query: SELECT 1}]":          "statement 0 has no name",
+		"statements: [{name: a, input: in.csv}]":   "statement a has no query",
+		"statements: [{name: a, query: SELECT 1}]": "statement a has no input",
+		"statements: [{name: a, query: SELECT 1, query_file: a.sql, input: in.csv}]":                         "statement a: query and query_file can't be used together",
+		"statements: [{name: a, query: SELECT 1, input: in.csv, weight: -1}]":                                "statement a: weight must be at least 1",
+		"statements: [{name: a, query: SELECT 1, input: in.csv}, {name: a, query: SELECT 2, input: in.csv}]": "statement a: duplicate statement name",
+		"statements: [{name: a, query: SELECT 1, input: missing.csv}]":                                       "cannot open input file",
+		"statements: [{name: a, query_file: a.sql, input: in.csv}]":                                          "cannot read query file",
+	}
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "in.csv"), []byte("id\n1\n"), 0o600))
+	for content, expected := range cases {
+		path := filepath.Join(dir, "workload.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		err := (&workload{}).load(path, false)
+		if assert.Error(t, err, content) {
+			assert.Contains(t, err.Error(), expected, content)
+		}
+	}
+}
+
+func TestWorkload_Interleave(t *testing.T) {
+	w := &workload{}
+	require.NoError(t, w.add(&db.Statement{Name: "a"}, strings.NewReader("id\n1\n2\n3\n4\n5\n6\n"), 2))
+	require.NoError(t, w.add(&db.Statement{Name: "b"}, strings.NewReader("id\n1\n2\n3\n"), 1))
+
+	var order []string
+	for {
+		q, err := w.Read()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		order = append(order, q.Statement+q.Params[0])
+	}
+	assert.Equal(t, []string{"a1", "b1", "a2", "a3", "b2", "a4", "a5", "b3", "a6"}, order)
+}
+
+func TestWorkload_Rewind(t *testing.T) {
+	w := &workload{}
+	require.NoError(t, w.add(&db.Statement{Name: "a"}, strings.NewReader("id\n1\n2\n3\n4\n"), 2))
+	require.NoError(t, w.add(&db.Statement{Name: "b"}, strings.NewReader("id\n1\n2\n3\n"), 1))
+
+	var passes [][]string
+	for i := 0; i < 2; i++ {
+		var order []string
+		for {
+			q, err := w.Read()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			order = append(order, q.Statement+q.Params[0])
+		}
+		passes = append(passes, order)
+		require.NoError(t, w.rewind())
+	}
+	assert.Equal(t, passes[0], passes[1])
+	assert.Equal(t, []string{"a1", "b1", "a2", "a3", "b2", "a4"}, passes[0])
+}
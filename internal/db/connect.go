@@ -9,37 +9,83 @@ import (
 	"time"
 
 	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
 )
 
-var retryWaitDuration = time.Second
+var (
+	retryWaitDuration = time.Second
+	reconnectMinWait  = 50 * time.Millisecond
+)
 
 // Conn is a subset of pgx.Conn's public interface, mocked by MockConn.
 type Conn interface {
 	Close(ctx context.Context) error
 	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+	IsClosed() bool
 	Prepare(ctx context.Context, name, sql string) (sd *pgconn.StatementDescription, err error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
 }
 
 // ConnectFunc is used to instantiate a database connection.
 type ConnectFunc func(ctx context.Context) (Conn, error)
 
-// WaitFor tries connecting to the database every second until it succeeds or the context times out.
-func WaitFor(ctx context.Context, connect ConnectFunc) error {
-	ticker := time.NewTicker(retryWaitDuration)
-	defer ticker.Stop()
-	for {
-		c, err := connect(ctx)
-		if err != nil {
-			_, _ = fmt.Fprintf(os.Stderr, "%s\n", err)
-		} else {
-			return c.Close(ctx)
+// AcquireFunc is used to acquire a connection from a pool, release must be called once it is no longer used.
+type AcquireFunc func(ctx context.Context) (conn Conn, release func(), err error)
+
+// WaitFor tries connecting to each database every second until it succeeds or the context times out.
+// When benchmarking several databases, the error holds the 1-based index of the first unavailable one.
+func WaitFor(ctx context.Context, connect ...ConnectFunc) error {
+	for i, fn := range connect {
+		if err := waitFor(ctx, fn); err != nil {
+			if len(connect) > 1 {
+				return fmt.Errorf("%w: target %d", err, i+1)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func waitFor(ctx context.Context, connect ConnectFunc) error {
+	var conn Conn
+	err := retry(ctx, func(int) time.Duration { return retryWaitDuration }, func() error {
+		var err error
+		conn, err = connect(ctx)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("database unavailable")
+	}
+	return conn.Close(ctx)
+}
+
+// retry calls fn until it succeeds, waiting between attempts, and returns the last error if the context is done first.
+// Errors are printed to stderr.
+func retry(ctx context.Context, wait func(attempt int) time.Duration, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
 		}
+		_, _ = fmt.Fprintf(os.Stderr, "%s\n", err)
 
+		timer := time.NewTimer(wait(attempt))
 		select {
 		case <-ctx.Done():
-			return fmt.Errorf("database unavailable")
-		case <-ticker.C:
+			timer.Stop()
+			return err
+		case <-timer.C:
 			continue
 		}
 	}
 }
+
+// backoff returns the exponential wait duration before a reconnection attempt, capped to retryWaitDuration.
+func backoff(attempt int) time.Duration {
+	wait := retryWaitDuration
+	if attempt < 16 && reconnectMinWait<<attempt < wait {
+		wait = reconnectMinWait << attempt
+	}
+	return wait
+}
@@ -43,3 +43,31 @@ func TestWaitFor_Fail(t *testing.T) {
 	}), "database unavailable")
 	assert.Greater(t, retries, uint64(10))
 }
+
+func TestWaitFor_Targets(t *testing.T) {
+	retryWaitDuration = time.Millisecond
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+	conn.EXPECT().
+		Close(gomock.Any()).
+		Return(nil)
+
+	// The second target is never available
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.EqualError(t, WaitFor(ctx, func(ctx context.Context) (Conn, error) {
+		return conn, nil
+	}, func(ctx context.Context) (Conn, error) {
+		return nil, fmt.Errorf("not ready")
+	}), "database unavailable: target 2")
+}
+
+func TestBackoff(t *testing.T) {
+	retryWaitDuration = time.Second
+	reconnectMinWait = 50 * time.Millisecond
+	assert.Equal(t, 50*time.Millisecond, backoff(0))
+	assert.Equal(t, 100*time.Millisecond, backoff(1))
+	assert.Equal(t, 800*time.Millisecond, backoff(4))
+	assert.Equal(t, time.Second, backoff(5))
+	assert.Equal(t, time.Second, backoff(100))
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/xvello/pgbench/internal/stats"
+)
+
+// DatasetTable is the hypertable queried by the default statement.
+const DatasetTable = "cpu_usage"
+
+const (
+	// hypertableQuery reads the estimated row count, chunks and compression status of the hypertable.
+	// The chunk interval is the longest time range of its chunks, in milliseconds.
+	hypertableQuery = `SELECT h.compression_enabled, approximate_row_count($1::regclass),
+  count(c.chunk_name), count(c.chunk_name) FILTER (WHERE c.is_compressed),
+  coalesce(extract(epoch FROM max(c.range_end - c.range_start)) * 1000, 0)::float8
+FROM timescaledb_information.hypertables h
+LEFT JOIN timescaledb_information.chunks c USING (hypertable_schema, hypertable_name)
+WHERE format('%I.%I', h.hypertable_schema, h.hypertable_name)::regclass = to_regclass($1)
+GROUP BY h.compression_enabled`
+	// timeRangeQuery reads the time range of the data, NULL if the hypertable is empty.
+	timeRangeQuery = `SELECT min(ts), max(ts) FROM ` + DatasetTable
+	// hostsQuery counts the given hosts found in the data.
+	hostsQuery = `SELECT count(DISTINCT host) FROM ` + DatasetTable + ` WHERE host = ANY($1)`
+)
+
+// InspectDataset returns the fingerprint of the hypertable queried by the default statement, counting the given
+// hosts found in its data.
+func InspectDataset(ctx context.Context, conn Conn, hosts []string) (*stats.Dataset, error) {
+	d := &stats.Dataset{Table: DatasetTable}
+	found, err := queryRow(ctx, conn, hypertableQuery, []interface{}{DatasetTable},
+		&d.CompressionEnabled, &d.RowEstimate, &d.Chunks, &d.CompressedChunks, &d.ChunkInterval)
+	if err != nil {
+		return nil, fmt.Errorf("cannot inspect %s: %w", DatasetTable, err)
+	}
+	if !found {
+		return nil, fmt.Errorf("%s is not a TimescaleDB hypertable", DatasetTable)
+	}
+
+	var min, max *time.Time
+	if _, err = queryRow(ctx, conn, timeRangeQuery, nil, &min, &max); err != nil {
+		return nil, fmt.Errorf("cannot read the time range of %s: %w", DatasetTable, err)
+	}
+	d.MinTime, d.MaxTime = min, max
+
+	if len(hosts) > 0 {
+		var count int64
+		if _, err = queryRow(ctx, conn, hostsQuery, []interface{}{hosts}, &count); err != nil {
+			return nil, fmt.Errorf("cannot look up the input hosts in %s: %w", DatasetTable, err)
+		}
+		d.InputHosts = len(hosts)
+		d.HostsFound = int(count)
+	}
+	return d, nil
+}
+
+// queryRow scans the first row returned by a query, and returns whether there was one.
+func queryRow(ctx context.Context, conn Conn, sql string, args []interface{}, dest ...interface{}) (bool, error) {
+	rows, err := conn.Query(ctx, sql, args...)
+	if err != nil {
+		return false, err
+	}
+	found := rows.Next()
+	if found {
+		err = rows.Scan(dest...)
+	}
+	rows.Close()
+	if err == nil {
+		err = rows.Err()
+	}
+	return found, err
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xvello/pgbench/internal/db/mock"
+	"github.com/xvello/pgbench/internal/stats"
+)
+
+func TestInspectDataset(t *testing.T) {
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+	min := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	max := time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC)
+	hosts := []string{"host_000001", "host_000002"}
+	gomock.InOrder(
+		conn.EXPECT().
+			Query(gomock.Any(), hypertableQuery, DatasetTable).
+			Return(newStatRows(
+				[]interface{}{true, int64(3456000), int64(2), int64(1), float64(604800000)},
+			), nil),
+		conn.EXPECT().
+			Query(gomock.Any(), timeRangeQuery).
+			Return(newStatRows([]interface{}{&min, &max}), nil),
+		conn.EXPECT().
+			Query(gomock.Any(), hostsQuery, hosts).
+			Return(newStatRows([]interface{}{int64(1)}), nil),
+	)
+
+	dataset, err := InspectDataset(context.Background(), conn, hosts)
+	require.NoError(t, err)
+	assert.Equal(t, &stats.Dataset{
+		Table:              DatasetTable,
+		RowEstimate:        3456000,
+		Chunks:             2,
+		CompressedChunks:   1,
+		CompressionEnabled: true,
+		ChunkInterval:      604800000,
+		MinTime:            &min,
+		MaxTime:            &max,
+		InputHosts:         2,
+		HostsFound:         1,
+	}, dataset)
+}
+
+func TestInspectDataset_Empty(t *testing.T) {
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+	gomock.InOrder(
+		conn.EXPECT().
+			Query(gomock.Any(), hypertableQuery, DatasetTable).
+			Return(newStatRows(
+				[]interface{}{false, int64(0), int64(0), int64(0), float64(0)},
+			), nil),
+		conn.EXPECT().
+			Query(gomock.Any(), timeRangeQuery).
+			Return(newStatRows([]interface{}{(*time.Time)(nil), (*time.Time)(nil)}), nil),
+	)
+
+	// Hosts are not looked up without input
+	dataset, err := InspectDataset(context.Background(), conn, nil)
+	require.NoError(t, err)
+	assert.Equal(t, &stats.Dataset{Table: DatasetTable}, dataset)
+}
+
+func TestInspectDataset_NotHypertable(t *testing.T) {
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+	conn.EXPECT().
+		Query(gomock.Any(), hypertableQuery, DatasetTable).
+		Return(newStatRows(), nil)
+	_, err := InspectDataset(context.Background(), conn, nil)
+	assert.EqualError(t, err, "cpu_usage is not a TimescaleDB hypertable")
+
+	conn.EXPECT().
+		Query(gomock.Any(), hypertableQuery, DatasetTable).
+		Return(nil, fmt.Errorf(`schema "timescaledb_information" does not exist`))
+	_, err = InspectDataset(context.Background(), conn, nil)
+	assert.EqualError(t, err, `cannot inspect cpu_usage: schema "timescaledb_information" does not exist`)
+}
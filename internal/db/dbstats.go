@@ -0,0 +1,106 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/xvello/pgbench/internal/stats"
+)
+
+// CheckpointerVersion is the first server version reporting the checkpoints in pg_stat_checkpointer instead of
+// pg_stat_bgwriter. It no longer reports the buffers written by the backends.
+const CheckpointerVersion = 170000
+
+const (
+	// serverVersionQuery reads the server version as a number, 170000 for 17.0.
+	serverVersionQuery = `SELECT current_setting('server_version_num')::int`
+	// databaseCountersQuery reads the counters of the current database, and the number of lock requests waiting.
+	databaseCountersQuery = `SELECT d.xact_commit, d.xact_rollback, d.blks_read, d.blks_hit, d.temp_bytes, d.deadlocks,
+  (SELECT count(*) FROM pg_locks WHERE NOT granted)
+FROM pg_stat_database d
+WHERE d.datname = current_database()`
+	// bgwriterQuery reads the checkpoint and buffer counters of the background writer, before PostgreSQL 17.
+	bgwriterQuery = `SELECT checkpoints_timed, checkpoints_req, buffers_checkpoint, buffers_backend FROM pg_stat_bgwriter`
+	// checkpointerQuery reads the checkpoint counters since PostgreSQL 17.
+	checkpointerQuery = `SELECT num_timed, num_requested, buffers_written, NULL::bigint FROM pg_stat_checkpointer`
+	// waitEventsQuery counts the active backends of the current database by wait event, the ones not waiting
+	// are running on CPU.
+	waitEventsQuery = `SELECT coalesce(wait_event_type || ':' || wait_event, 'CPU'), count(*)
+FROM pg_stat_activity
+WHERE datname = current_database() AND state = 'active' AND pid <> pg_backend_pid()
+GROUP BY 1`
+)
+
+// ReadServerVersionNum reads the server version as a number, to select the statistics views to read.
+func ReadServerVersionNum(ctx context.Context, conn Conn) (int, error) {
+	var version int32
+	if _, err := queryRow(ctx, conn, serverVersionQuery, nil, &version); err != nil {
+		return 0, fmt.Errorf("cannot read server version: %w", err)
+	}
+	return int(version), nil
+}
+
+// ReadDatabaseCounters reads the statistics views of the database. The checkpoint views depend on the server
+// version, counters the server does not report are left nil.
+func ReadDatabaseCounters(ctx context.Context, conn Conn, version int) (stats.DatabaseCounters, error) {
+	var c stats.DatabaseCounters
+	var values [7]int64
+	dest := make([]interface{}, len(values))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	found, err := queryRow(ctx, conn, databaseCountersQuery, nil, dest...)
+	if err == nil && !found {
+		err = fmt.Errorf("no row in pg_stat_database for the current database")
+	}
+	if err != nil {
+		return c, fmt.Errorf("cannot read database statistics: %w", err)
+	}
+	c.Commits = uint64(values[0])
+	c.Rollbacks = uint64(values[1])
+	c.BlocksRead = uint64(values[2])
+	c.BlocksHit = uint64(values[3])
+	c.TempBytes = uint64(values[4])
+	c.Deadlocks = uint64(values[5])
+	c.LockWaits = int(values[6])
+
+	query, view := bgwriterQuery, "pg_stat_bgwriter"
+	if version >= CheckpointerVersion {
+		query, view = checkpointerQuery, "pg_stat_checkpointer"
+	}
+	var timed, requested, written int64
+	var backend *int64
+	found, err = queryRow(ctx, conn, query, nil, &timed, &requested, &written, &backend)
+	if err == nil && !found {
+		err = fmt.Errorf("no row in %s", view)
+	}
+	if err != nil {
+		return c, fmt.Errorf("cannot read checkpoint statistics: %w", err)
+	}
+	c.CheckpointsTimed = uint64(timed)
+	c.CheckpointsRequested = uint64(requested)
+	c.BuffersCheckpoint = uint64(written)
+	if backend != nil {
+		buffers := uint64(*backend)
+		c.BuffersBackend = &buffers
+	}
+
+	rows, err := conn.Query(ctx, waitEventsQuery)
+	if err != nil {
+		return c, fmt.Errorf("cannot read wait events: %w", err)
+	}
+	defer rows.Close()
+	c.WaitEvents = make(map[string]int)
+	for rows.Next() {
+		var event string
+		var count int64
+		if err = rows.Scan(&event, &count); err != nil {
+			return c, fmt.Errorf("cannot read wait events: %w", err)
+		}
+		c.WaitEvents[event] = int(count)
+	}
+	if err = rows.Err(); err != nil {
+		return c, fmt.Errorf("cannot read wait events: %w", err)
+	}
+	return c, nil
+}
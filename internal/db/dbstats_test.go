@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xvello/pgbench/internal/db/mock"
+	"github.com/xvello/pgbench/internal/stats"
+)
+
+func TestReadServerVersionNum(t *testing.T) {
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+	conn.EXPECT().
+		Query(gomock.Any(), serverVersionQuery).
+		Return(newStatRows([]interface{}{int32(160004)}), nil)
+
+	version, err := ReadServerVersionNum(context.Background(), conn)
+	require.NoError(t, err)
+	assert.Equal(t, 160004, version)
+}
+
+func TestReadDatabaseCounters(t *testing.T) {
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+	backend := int64(10)
+	gomock.InOrder(
+		conn.EXPECT().
+			Query(gomock.Any(), databaseCountersQuery).
+			Return(newStatRows(
+				[]interface{}{int64(1), int64(2), int64(3), int64(4), int64(5), int64(6), int64(11)},
+			), nil),
+		conn.EXPECT().
+			Query(gomock.Any(), bgwriterQuery).
+			Return(newStatRows(
+				[]interface{}{int64(7), int64(8), int64(9), &backend},
+			), nil),
+		conn.EXPECT().
+			Query(gomock.Any(), waitEventsQuery).
+			Return(newStatRows(
+				[]interface{}{"CPU", int64(4)},
+				[]interface{}{"IO:DataFileRead", int64(2)},
+			), nil),
+	)
+
+	counters, err := ReadDatabaseCounters(context.Background(), conn, 160004)
+	require.NoError(t, err)
+	buffers := uint64(10)
+	assert.Equal(t, stats.DatabaseCounters{
+		Commits:              1,
+		Rollbacks:            2,
+		BlocksRead:           3,
+		BlocksHit:            4,
+		TempBytes:            5,
+		Deadlocks:            6,
+		CheckpointsTimed:     7,
+		CheckpointsRequested: 8,
+		BuffersCheckpoint:    9,
+		BuffersBackend:       &buffers,
+		WaitEvents:           map[string]int{"CPU": 4, "IO:DataFileRead": 2},
+		LockWaits:            11,
+	}, counters)
+
+	conn.EXPECT().
+		Query(gomock.Any(), databaseCountersQuery).
+		Return(nil, fmt.Errorf("permission denied for view pg_stat_database"))
+	_, err = ReadDatabaseCounters(context.Background(), conn, 160004)
+	assert.EqualError(t, err, "cannot read database statistics: permission denied for view pg_stat_database")
+}
+
+func TestReadDatabaseCounters_Checkpointer(t *testing.T) {
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+	gomock.InOrder(
+		conn.EXPECT().
+			Query(gomock.Any(), databaseCountersQuery).
+			Return(newStatRows(
+				[]interface{}{int64(1), int64(2), int64(3), int64(4), int64(5), int64(6), int64(0)},
+			), nil),
+		// PostgreSQL 17 moved the checkpoints to pg_stat_checkpointer, and dropped the backend buffers
+		conn.EXPECT().
+			Query(gomock.Any(), checkpointerQuery).
+			Return(newStatRows(
+				[]interface{}{int64(7), int64(8), int64(9), (*int64)(nil)},
+			), nil),
+		conn.EXPECT().
+			Query(gomock.Any(), waitEventsQuery).
+			Return(newStatRows(), nil),
+	)
+
+	counters, err := ReadDatabaseCounters(context.Background(), conn, 170002)
+	require.NoError(t, err)
+	assert.EqualValues(t, 7, counters.CheckpointsTimed)
+	assert.EqualValues(t, 8, counters.CheckpointsRequested)
+	assert.EqualValues(t, 9, counters.BuffersCheckpoint)
+	assert.Nil(t, counters.BuffersBackend)
+}
+
+func TestReadDatabaseCounters_MissingRow(t *testing.T) {
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+	conn.EXPECT().
+		Query(gomock.Any(), databaseCountersQuery).
+		Return(newStatRows(), nil)
+	_, err := ReadDatabaseCounters(context.Background(), conn, 160004)
+	assert.EqualError(t, err, "cannot read database statistics: no row in pg_stat_database for the current database")
+
+	conn.EXPECT().
+		Query(gomock.Any(), databaseCountersQuery).
+		Return(newStatRows(
+			[]interface{}{int64(1), int64(2), int64(3), int64(4), int64(5), int64(6), int64(0)},
+		), nil)
+	conn.EXPECT().
+		Query(gomock.Any(), checkpointerQuery).
+		Return(newStatRows(), nil)
+	_, err = ReadDatabaseCounters(context.Background(), conn, 170002)
+	assert.EqualError(t, err, "cannot read checkpoint statistics: no row in pg_stat_checkpointer")
+}
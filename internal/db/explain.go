@@ -0,0 +1,100 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/xvello/pgbench/internal/stats"
+)
+
+// explainPrefix runs a statement and returns its plan with the server-side timings and buffer usage.
+const explainPrefix = "EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) "
+
+// explainOutput is the subset of the JSON EXPLAIN output read. The buffers of the top-level node include
+// the ones of its children.
+type explainOutput []struct {
+	Plan struct {
+		SharedHitBlocks  uint64 `json:"Shared Hit Blocks"`
+		SharedReadBlocks uint64 `json:"Shared Read Blocks"`
+	} `json:"Plan"`
+	PlanningTime  float64 `json:"Planning Time"`
+	ExecutionTime float64 `json:"Execution Time"`
+}
+
+// RunExplains executes the queries received from the input with EXPLAIN ANALYZE on a dedicated connection, so that
+// the workers' connections are unaffected, and reports their server-side measures until the input is closed.
+// Failed explains are reported, but do not stop the sampling.
+func RunExplains(ctx context.Context, connect ConnectFunc, statements []*Statement, input <-chan *Query, output chan<- stats.Result) error {
+	conn, err := connect(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot open explain connection: %w", err)
+	}
+	texts := make(map[string]string, len(statements))
+	for _, s := range statements {
+		texts[s.Name] = s.Text
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return closeConn(conn)
+		case query, ok := <-input:
+			if !ok {
+				return closeConn(conn)
+			}
+			sample, err := explain(ctx, conn, texts[query.Statement], query)
+			if ctx.Err() != nil {
+				return closeConn(conn)
+			}
+			if err != nil {
+				sample = &stats.ExplainSample{}
+			}
+			output <- stats.Result{Statement: query.Statement, Key: query.Key, Explain: sample, Err: err}
+			if err != nil && conn.IsClosed() {
+				if conn, err = connect(ctx); err != nil {
+					return fmt.Errorf("cannot open explain connection: %w", err)
+				}
+			}
+		}
+	}
+}
+
+// explain runs the query with EXPLAIN ANALYZE and parses its output.
+func explain(ctx context.Context, conn Conn, text string, query *Query) (*stats.ExplainSample, error) {
+	rows, err := conn.Query(ctx, explainPrefix+text, query.Args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("empty explain output")
+	}
+	var out explainOutput
+	if err = json.Unmarshal(rows.RawValues()[0], &out); err != nil {
+		return nil, fmt.Errorf("cannot parse explain output: %w", err)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("empty explain output")
+	}
+	// Closing the rows reads the end of the response, and the query error if any
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return &stats.ExplainSample{
+		Planning:   msToDuration(out[0].PlanningTime),
+		Execution:  msToDuration(out[0].ExecutionTime),
+		SharedHit:  out[0].Plan.SharedHitBlocks,
+		SharedRead: out[0].Plan.SharedReadBlocks,
+	}, nil
+}
+
+// msToDuration converts the milliseconds of the EXPLAIN output.
+func msToDuration(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
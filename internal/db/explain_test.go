@@ -0,0 +1,58 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/xvello/pgbench/internal/db/mock"
+	"github.com/xvello/pgbench/internal/stats"
+)
+
+func TestRunExplains(t *testing.T) {
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+	params := []string{"host_000008", "2017-01-01 08:59:22", "2017-01-01 09:59:22"}
+	output := `[{"Plan": {"Node Type": "Sort", "Shared Hit Blocks": 120, "Shared Read Blocks": 8}, "Planning Time": 0.25, "Execution Time": 1.5}]`
+
+	gomock.InOrder(
+		conn.EXPECT().
+			Query(gomock.Any(), explainPrefix+TimeBucketQueryText, params[0], params[1], params[2]).
+			Return(&fakeRows{values: [][][]byte{{[]byte(output)}}}, nil),
+		conn.EXPECT().
+			Query(gomock.Any(), explainPrefix+TimeBucketQueryText, gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(nil, fmt.Errorf("permission denied")),
+		conn.EXPECT().
+			IsClosed().
+			Return(false),
+		conn.EXPECT().
+			Close(gomock.Any()).
+			Return(nil),
+	)
+
+	queryChan := make(chan *Query, 2)
+	resultChan := make(chan stats.Result, 2)
+	queryChan <- &Query{Statement: TimeBucketQueryName, Params: params, Key: params[0]}
+	queryChan <- &Query{Statement: TimeBucketQueryName, Params: params, Key: params[0]}
+	close(queryChan)
+
+	assert.NoError(t, RunExplains(context.Background(), func(ctx context.Context) (Conn, error) {
+		return conn, nil
+	}, []*Statement{DefaultStatement()}, queryChan, resultChan))
+
+	r := <-resultChan
+	assert.NoError(t, r.Err)
+	assert.Equal(t, "host_000008", r.Key)
+	assert.Equal(t, &stats.ExplainSample{
+		Planning:   250 * time.Microsecond,
+		Execution:  1500 * time.Microsecond,
+		SharedHit:  120,
+		SharedRead: 8,
+	}, r.Explain)
+	r = <-resultChan
+	assert.EqualError(t, r.Err, "permission denied")
+	assert.NotNil(t, r.Explain)
+}
@@ -5,6 +5,10 @@ import (
 	"fmt"
 	"hash/fnv"
 	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 // Exported for use in bench_test.go.
@@ -17,34 +21,106 @@ GROUP BY bucket
 ORDER BY bucket ASC;`
 )
 
-// Query holds one set of input parameters.
-// Timestamps are assumed valid and kept as strings for simplicity.
+// Statement is a SQL statement prepared on every worker connection.
+// Its $1..$n placeholders are bound positionally to the input columns.
+type Statement struct {
+	Name string
+	Text string
+}
+
+// DefaultStatement returns the time bucket statement used when no query is provided.
+func DefaultStatement() *Statement {
+	return &Statement{Name: TimeBucketQueryName, Text: TimeBucketQueryText}
+}
+
+// LoadStatement reads a statement from a file, naming it after the file's base name.
+func LoadStatement(path string) (*Statement, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read query file: %w", err)
+	}
+	if strings.TrimSpace(string(text)) == "" {
+		return nil, fmt.Errorf("query file %s is empty", path)
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return &Statement{Name: name, Text: string(text)}, nil
+}
+
+// Query holds one set of input parameters, bound positionally to the placeholders of the named statement.
+// Values are kept as strings and cast by the server for simplicity.
+// Key is the value of the input column used for worker routing.
+// Warmup queries are executed but excluded from the report, Stage holds the 1-based index of the load stage if set.
+// In open-loop mode, Scheduled holds the intended start time of the query. Enqueued is the time it was sent
+// to the workers' queues, if set.
+// Done is called by the worker once the result of the query is reported, if set.
 type Query struct {
-	Hostname  string
-	StartTime string
-	EndTime   string
+	Statement string
+	Params    []string
+	Key       string
+	Warmup    bool
+	Stage     int
+	Scheduled time.Time
+	Enqueued  time.Time
+	Done      func()
+}
+
+// Args returns the parameters in the form expected by Conn.Exec.
+func (q *Query) Args() []interface{} {
+	args := make([]interface{}, len(q.Params))
+	for i, p := range q.Params {
+		args[i] = p
+	}
+	return args
 }
 
-// Hash returns the consistent hash to be used for worker routing.
+// reported calls Done if set.
+func (q *Query) reported() {
+	if q.Done != nil {
+		q.Done()
+	}
+}
+
+// Hash returns the consistent hash of the routing key, to be used for worker routing.
 func (q *Query) Hash() uint64 {
 	hash := fnv.New64()
-	_, _ = hash.Write([]byte(q.Hostname))
+	_, _ = hash.Write([]byte(q.Key))
 	return hash.Sum64()
 }
 
 // QueryParser parses the input queries one by one.
 type QueryParser struct {
-	lines *csv.Reader
+	input  io.Reader
+	lines  *csv.Reader
+	header []string
+	key    int
 }
 
 // NewQueryParser returns a new QueryParser.
 func NewQueryParser(input io.Reader) (*QueryParser, error) {
-	lines := csv.NewReader(input)
-	// Skip header line
-	if _, err := lines.Read(); err != nil {
+	p := &QueryParser{input: input}
+	if err := p.open(); err != nil {
 		return nil, fmt.Errorf("cannot open input: %w", err)
 	}
-	return &QueryParser{lines: lines}, nil
+	return p, nil
+}
+
+func (p *QueryParser) open() error {
+	p.lines = csv.NewReader(p.input)
+	// Read header line, the following records must have the same number of fields
+	header, err := p.lines.Read()
+	p.header = header
+	return err
+}
+
+// SetRoutingKey selects the input column used as routing key, instead of the first one.
+func (p *QueryParser) SetRoutingKey(column string) error {
+	for i, name := range p.header {
+		if name == column {
+			p.key = i
+			return nil
+		}
+	}
+	return fmt.Errorf("routing key %s not found in input columns %v", column, p.header)
 }
 
 // Read returns the next query in the input set, or io.EOF when finished.
@@ -53,12 +129,20 @@ func (p *QueryParser) Read() (*Query, error) {
 	if err != nil {
 		return nil, err
 	}
-	if len(record) != 3 {
-		return nil, fmt.Errorf("invalid record: %v", record)
+	return &Query{Params: record, Key: record[p.key]}, nil
+}
+
+// Rewind restarts reading from the first query, if the input supports seeking.
+func (p *QueryParser) Rewind() error {
+	seeker, ok := p.input.(io.Seeker)
+	if !ok {
+		return fmt.Errorf("input cannot be rewound")
+	}
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("cannot rewind input: %w", err)
+	}
+	if err := p.open(); err != nil {
+		return fmt.Errorf("cannot rewind input: %w", err)
 	}
-	return &Query{
-		Hostname:  record[0],
-		StartTime: record[1],
-		EndTime:   record[2],
-	}, nil
+	return nil
 }
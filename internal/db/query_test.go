@@ -2,6 +2,8 @@ package db
 
 import (
 	"io"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -21,9 +23,8 @@ host_000002,2017-01-02 00:25:56,2017-01-02 01:25:56
 	query, err := reader.Read()
 	assert.NoError(t, err)
 	assert.Equal(t, &Query{
-		Hostname:  "host_000008",
-		StartTime: "2017-01-01 08:59:22",
-		EndTime:   "2017-01-01 09:59:22",
+		Params: []string{"host_000008", "2017-01-01 08:59:22", "2017-01-01 09:59:22"},
+		Key:    "host_000008",
 	}, query)
 
 	query, err = reader.Read()
@@ -33,12 +34,84 @@ host_000002,2017-01-02 00:25:56,2017-01-02 01:25:56
 	query, err = reader.Read()
 	assert.NoError(t, err)
 	assert.Equal(t, &Query{
-		Hostname:  "host_000002",
-		StartTime: "2017-01-02 00:25:56",
-		EndTime:   "2017-01-02 01:25:56",
+		Params: []string{"host_000002", "2017-01-02 00:25:56", "2017-01-02 01:25:56"},
+		Key:    "host_000002",
 	}, query)
 
 	query, err = reader.Read()
 	assert.Equal(t, io.EOF, err)
 	assert.Nil(t, query)
 }
+
+func TestQueryParser_ReadColumns(t *testing.T) {
+	csvInput := `hostname,limit
+host_000008,10
+host_000002
+`
+	reader, err := NewQueryParser(strings.NewReader(csvInput))
+	require.NoError(t, err)
+
+	query, err := reader.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"host_000008", "10"}, query.Args())
+
+	query, err = reader.Read()
+	assert.EqualError(t, err, "record on line 3: wrong number of fields")
+	assert.Nil(t, query)
+}
+
+func TestQueryParser_Rewind(t *testing.T) {
+	csvInput := `hostname
+host_000008
+host_000002
+`
+	reader, err := NewQueryParser(strings.NewReader(csvInput))
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		query, err := reader.Read()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"host_000008"}, query.Params)
+		query, err = reader.Read()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"host_000002"}, query.Params)
+		_, err = reader.Read()
+		assert.Equal(t, io.EOF, err)
+		assert.NoError(t, reader.Rewind())
+	}
+
+	reader, err = NewQueryParser(io.MultiReader(strings.NewReader(csvInput)))
+	require.NoError(t, err)
+	assert.EqualError(t, reader.Rewind(), "input cannot be rewound")
+}
+
+func TestQueryParser_SetRoutingKey(t *testing.T) {
+	csvInput := `region,hostname
+eu,host_000008
+`
+	reader, err := NewQueryParser(strings.NewReader(csvInput))
+	require.NoError(t, err)
+	assert.EqualError(t, reader.SetRoutingKey("host"), "routing key host not found in input columns [region hostname]")
+	require.NoError(t, reader.SetRoutingKey("hostname"))
+
+	query, err := reader.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, "host_000008", query.Key)
+	assert.Equal(t, (&Query{Key: "host_000008"}).Hash(), query.Hash())
+}
+
+func TestLoadStatement(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "last-point.sql")
+	require.NoError(t, os.WriteFile(path, []byte("SELECT * FROM cpu_usage WHERE host = $1 ORDER BY ts DESC LIMIT 1"), 0o600))
+
+	stmt, err := LoadStatement(path)
+	require.NoError(t, err)
+	assert.Equal(t, &Statement{
+		Name: "last-point",
+		Text: "SELECT * FROM cpu_usage WHERE host = $1 ORDER BY ts DESC LIMIT 1",
+	}, stmt)
+
+	empty := filepath.Join(t.TempDir(), "empty.sql")
+	require.NoError(t, os.WriteFile(empty, []byte("\n"), 0o600))
+	_, err = LoadStatement(empty)
+	assert.EqualError(t, err, "query file "+empty+" is empty")
+}
@@ -0,0 +1,44 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/xvello/pgbench/internal/stats"
+)
+
+// ReportedSettings are the server settings added to the report, as they impact the query plans and performance.
+var ReportedSettings = []string{"shared_buffers", "work_mem", "jit", "max_parallel_workers_per_gather"}
+
+const (
+	// versionsQuery reads the server version, and the TimescaleDB version if the extension is installed.
+	versionsQuery = `SELECT current_setting('server_version'),
+  coalesce((SELECT extversion FROM pg_extension WHERE extname = 'timescaledb'), '')`
+	// settingsQuery reads the given settings with their units.
+	settingsQuery = `SELECT name, current_setting(name) FROM pg_settings WHERE name = ANY($1)`
+)
+
+// ReadServerInfo reads the versions and the reported settings of the server.
+func ReadServerInfo(ctx context.Context, conn Conn) (*stats.ServerInfo, error) {
+	info := &stats.ServerInfo{Settings: make(map[string]string, len(ReportedSettings))}
+	if _, err := queryRow(ctx, conn, versionsQuery, nil, &info.Version, &info.TimescaleVersion); err != nil {
+		return nil, fmt.Errorf("cannot read server version: %w", err)
+	}
+
+	rows, err := conn.Query(ctx, settingsQuery, ReportedSettings)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read server settings: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, value string
+		if err = rows.Scan(&name, &value); err != nil {
+			return nil, fmt.Errorf("cannot read server settings: %w", err)
+		}
+		info.Settings[name] = value
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read server settings: %w", err)
+	}
+	return info, nil
+}
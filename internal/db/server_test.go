@@ -0,0 +1,50 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xvello/pgbench/internal/db/mock"
+	"github.com/xvello/pgbench/internal/stats"
+)
+
+func TestReadServerInfo(t *testing.T) {
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+	gomock.InOrder(
+		conn.EXPECT().
+			Query(gomock.Any(), versionsQuery).
+			Return(newStatRows([]interface{}{"14.2", "2.6.0"}), nil),
+		conn.EXPECT().
+			Query(gomock.Any(), settingsQuery, ReportedSettings).
+			Return(newStatRows(
+				[]interface{}{"jit", "off"},
+				[]interface{}{"max_parallel_workers_per_gather", "2"},
+				[]interface{}{"shared_buffers", "128MB"},
+				[]interface{}{"work_mem", "4MB"},
+			), nil),
+	)
+
+	info, err := ReadServerInfo(context.Background(), conn)
+	require.NoError(t, err)
+	assert.Equal(t, &stats.ServerInfo{
+		Version:          "14.2",
+		TimescaleVersion: "2.6.0",
+		Settings: map[string]string{
+			"jit":                             "off",
+			"max_parallel_workers_per_gather": "2",
+			"shared_buffers":                  "128MB",
+			"work_mem":                        "4MB",
+		},
+	}, info)
+
+	conn.EXPECT().
+		Query(gomock.Any(), versionsQuery).
+		Return(nil, fmt.Errorf("conn closed"))
+	_, err = ReadServerInfo(context.Background(), conn)
+	assert.EqualError(t, err, "cannot read server version: conn closed")
+}
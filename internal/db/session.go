@@ -0,0 +1,103 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/xvello/pgbench/internal/stats"
+)
+
+// session provides a worker with the connection to execute its next queries on.
+type session interface {
+	// acquire returns the connection and its prepared statements, and the time spent waiting for it.
+	acquire(ctx context.Context) (Conn, map[string]*pgconn.StatementDescription, time.Duration, error)
+	// release hands the connection back once the queries are executed, failed is the last error if any.
+	release(ctx context.Context, failed error, end time.Time) error
+	// close closes the session when the worker returns.
+	close() error
+}
+
+// dedicatedSession keeps a connection for the whole run, reconnecting after a connection loss.
+type dedicatedSession struct {
+	index      int
+	connect    ConnectFunc
+	statements []*Statement
+	opts       Options
+	output     chan<- stats.Result
+	conn       Conn
+	prepared   map[string]*pgconn.StatementDescription
+}
+
+func newDedicatedSession(ctx context.Context, index int, connect ConnectFunc, statements []*Statement, opts Options, output chan<- stats.Result) (*dedicatedSession, error) {
+	conn, prepared, err := open(ctx, connect, statements, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &dedicatedSession{
+		index:      index,
+		connect:    connect,
+		statements: statements,
+		opts:       opts,
+		output:     output,
+		conn:       conn,
+		prepared:   prepared,
+	}, nil
+}
+
+func (s *dedicatedSession) acquire(context.Context) (Conn, map[string]*pgconn.StatementDescription, time.Duration, error) {
+	return s.conn, s.prepared, 0, nil
+}
+
+// release opens a new connection if the last query failed and closed the connection: after a connection loss,
+// or a query cancelled client-side. The time spent disconnected is reported.
+func (s *dedicatedSession) release(ctx context.Context, failed error, end time.Time) error {
+	if failed == nil || !s.conn.IsClosed() {
+		return nil
+	}
+	var err error
+	if s.conn, s.prepared, err = reopen(ctx, s.connect, s.statements, s.opts); err != nil {
+		return err
+	}
+	s.output <- stats.Result{Worker: s.index, Target: s.opts.Target, Reconnected: true, Disconnected: time.Since(end)}
+	return nil
+}
+
+func (s *dedicatedSession) close() error {
+	return closeConn(s.conn)
+}
+
+// pooledSession acquires a connection from a shared pool for each query, or batch of queries in pipeline mode.
+// Closed connections are replaced by the pool.
+type pooledSession struct {
+	acquireConn AcquireFunc
+	statements  []*Statement
+	releaseConn func()
+}
+
+func (s *pooledSession) acquire(ctx context.Context) (Conn, map[string]*pgconn.StatementDescription, time.Duration, error) {
+	start := time.Now()
+	conn, release, err := s.acquireConn(ctx)
+	wait := time.Since(start)
+	if err != nil {
+		return nil, nil, wait, fmt.Errorf("cannot acquire connection: %w", err)
+	}
+	// Statements are only prepared on the first use of each connection, pgx caches them by name
+	prepared, err := prepare(ctx, conn, s.statements)
+	if err != nil {
+		release()
+		return nil, nil, wait, err
+	}
+	s.releaseConn = release
+	return conn, prepared, wait, nil
+}
+
+func (s *pooledSession) release(context.Context, error, time.Time) error {
+	s.releaseConn()
+	return nil
+}
+
+func (s *pooledSession) close() error {
+	return nil
+}
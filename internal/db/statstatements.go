@@ -0,0 +1,111 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/xvello/pgbench/internal/stats"
+)
+
+// statStatementsQuery reads the pg_stat_statements counters of the statements run by the current user
+// on the current database.
+const statStatementsQuery = `SELECT query, calls, total_exec_time, shared_blks_hit, shared_blks_read,
+  temp_blks_read + temp_blks_written, wal_bytes::bigint
+FROM pg_stat_statements
+WHERE dbid = (SELECT oid FROM pg_database WHERE datname = current_database())
+  AND userid = (SELECT oid FROM pg_roles WHERE rolname = current_user)`
+
+var (
+	// Constants replaced by placeholders by pg_stat_statements: strings, and numbers not part of an identifier
+	constantPattern    = regexp.MustCompile(`'(?:[^']|'')*'|(?:^|[^\w$.])\d+(?:\.\d+)?`)
+	placeholderPattern = regexp.MustCompile(`\$(\d+)`)
+	spacePattern       = regexp.MustCompile(`\s+`)
+)
+
+// SnapshotStatements returns the pg_stat_statements counters of the given statements, by name.
+// pg_stat_statements replaces the constants of the queries with placeholders, the statements are matched
+// on their normalized text.
+func SnapshotStatements(ctx context.Context, conn Conn, statements []*Statement) (map[string]stats.StatementStats, error) {
+	type matcher struct {
+		name       string
+		params     int
+		normalized string
+	}
+	matchers := make([]matcher, len(statements))
+	for i, s := range statements {
+		params := placeholders(s.Text)
+		matchers[i] = matcher{name: s.Name, params: params, normalized: normalize(s.Text, params)}
+	}
+
+	rows, err := conn.Query(ctx, statStatementsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read pg_stat_statements: %w", err)
+	}
+	defer rows.Close()
+	snapshot := make(map[string]stats.StatementStats)
+	for rows.Next() {
+		var text string
+		var calls, hit, read, temp, wal int64
+		var total float64
+		if err = rows.Scan(&text, &calls, &total, &hit, &read, &temp, &wal); err != nil {
+			return nil, fmt.Errorf("cannot read pg_stat_statements: %w", err)
+		}
+		for _, m := range matchers {
+			if normalize(text, m.params) != m.normalized {
+				continue
+			}
+			// Entries of the same statement, for example run at the top level or nested, are merged
+			s := snapshot[m.name]
+			s.Add(stats.StatementStats{
+				Calls:            uint64(calls),
+				TotalExecTime:    total,
+				SharedBlocksHit:  uint64(hit),
+				SharedBlocksRead: uint64(read),
+				TempBlocks:       uint64(temp),
+				WalBytes:         uint64(wal),
+			})
+			snapshot[m.name] = s
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read pg_stat_statements: %w", err)
+	}
+	return snapshot, nil
+}
+
+// normalize makes a statement comparable with its pg_stat_statements text: constants, and the placeholders numbered
+// above the statement's params that replaced them, become $?. Whitespace is collapsed and the trailing semicolon removed.
+func normalize(text string, params int) string {
+	text = constantPattern.ReplaceAllStringFunc(text, func(c string) string {
+		if c[0] == '\'' {
+			return "$?"
+		}
+		// Keep the character preceding the number
+		if c[0] < '0' || c[0] > '9' {
+			return c[:1] + "$?"
+		}
+		return "$?"
+	})
+	text = placeholderPattern.ReplaceAllStringFunc(text, func(p string) string {
+		if n, _ := strconv.Atoi(p[1:]); n > params {
+			return "$?"
+		}
+		return p
+	})
+	text = spacePattern.ReplaceAllString(text, " ")
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), ";"))
+}
+
+// placeholders returns the highest $n placeholder of a statement.
+func placeholders(text string) int {
+	max := 0
+	for _, m := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+		if n, _ := strconv.Atoi(m[1]); n > max {
+			max = n
+		}
+	}
+	return max
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xvello/pgbench/internal/db/mock"
+	"github.com/xvello/pgbench/internal/stats"
+)
+
+// statRows returns rows of values assigned to the Scan destinations.
+type statRows struct {
+	*fakeRows
+	rows [][]interface{}
+}
+
+func newStatRows(rows ...[]interface{}) *statRows {
+	return &statRows{fakeRows: &fakeRows{values: make([][][]byte, len(rows))}, rows: rows}
+}
+
+func (r *statRows) Scan(dest ...interface{}) error {
+	for i, v := range r.rows[r.next-1] {
+		reflect.ValueOf(dest[i]).Elem().Set(reflect.ValueOf(v))
+	}
+	return nil
+}
+
+func TestNormalize(t *testing.T) {
+	// pg_stat_statements replaces the constants with the placeholders following the statement's ones
+	assert.Equal(t,
+		normalize(TimeBucketQueryText, 3),
+		normalize(`SELECT time_bucket($4, ts) as "bucket", min(usage), max(usage)
+FROM cpu_usage
+WHERE host = $1 AND ts >= $2 AND ts <= $3
+GROUP BY bucket
+ORDER BY bucket ASC`, 3))
+	assert.Equal(t, "SELECT * FROM cpu_usage2 WHERE host = $1 LIMIT $? OFFSET $?",
+		normalize("SELECT *  FROM cpu_usage2\n WHERE host = $1 LIMIT 10 OFFSET 2.5;", 1))
+	assert.Equal(t, "SELECT $?::text, $1 + $?", normalize("SELECT 'it''s'::text, $1 + $2", 1))
+	assert.Equal(t, 3, placeholders(TimeBucketQueryText))
+}
+
+func TestSnapshotStatements(t *testing.T) {
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+	conn.EXPECT().
+		Query(gomock.Any(), statStatementsQuery).
+		Return(newStatRows(
+			[]interface{}{"SELECT time_bucket($4, ts) as \"bucket\", min(usage), max(usage)\nFROM cpu_usage\nWHERE host = $1 AND ts >= $2 AND ts <= $3\nGROUP BY bucket\nORDER BY bucket ASC", int64(10), 25.0, int64(100), int64(5), int64(0), int64(0)},
+			[]interface{}{"SELECT pg_sleep($1)", int64(1), 1000.0, int64(0), int64(0), int64(0), int64(0)},
+			// Same statement, run nested in a function
+			[]interface{}{"SELECT time_bucket($4, ts) as \"bucket\", min(usage), max(usage) FROM cpu_usage WHERE host = $1 AND ts >= $2 AND ts <= $3 GROUP BY bucket ORDER BY bucket ASC;", int64(10), 15.0, int64(50), int64(5), int64(2), int64(0)},
+		), nil)
+
+	snapshot, err := SnapshotStatements(context.Background(), conn, []*Statement{DefaultStatement(), {Name: "insert", Text: "INSERT INTO cpu_usage VALUES ($1, $2, $3)"}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]stats.StatementStats{
+		TimeBucketQueryName: {
+			Calls:            20,
+			TotalExecTime:    40,
+			MeanExecTime:     2,
+			SharedBlocksHit:  150,
+			SharedBlocksRead: 10,
+			TempBlocks:       2,
+		},
+	}, snapshot)
+
+	conn.EXPECT().
+		Query(gomock.Any(), statStatementsQuery).
+		Return(nil, fmt.Errorf(`relation "pg_stat_statements" does not exist`))
+	_, err = SnapshotStatements(context.Background(), conn, []*Statement{DefaultStatement()})
+	assert.EqualError(t, err, `cannot read pg_stat_statements: relation "pg_stat_statements" does not exist`)
+}
@@ -2,32 +2,409 @@ package db
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
 	"github.com/xvello/pgbench/internal/stats"
 )
 
-// RunQueries executes database queries sequentially and reports latency and errors.
-// Latency is measured client-side and is impacted by network latency.
-func RunQueries(ctx context.Context, index int, connect ConnectFunc, input <-chan *Query, output chan<- stats.Result) error {
-	conn, err := connect(ctx)
+const (
+	// closeTimeout bounds the time spent closing a connection once the benchmark is interrupted.
+	closeTimeout = 5 * time.Second
+	// statementTimeoutGrace delays the client-side timeout when statement_timeout is set, to let the server
+	// cancel the query first and keep the connection open.
+	statementTimeoutGrace = time.Second
+	// queryCanceledCode is the SQLSTATE of queries cancelled by statement_timeout
+	queryCanceledCode = "57014"
+)
+
+// Protocols used to send the queries, the prepared one being the default.
+const (
+	ProtocolSimple   = "simple"   // Simple query protocol, parameters are interpolated client-side
+	ProtocolExtended = "extended" // Extended protocol with an unnamed statement, parsed and planned on each execution
+	ProtocolPrepared = "prepared" // Named statements prepared once per connection
+	ProtocolPipeline = "pipeline" // Prepared statements sent in batches, several queries per round-trip
+)
+
+// Options configures how workers execute the queries.
+type Options struct {
+	// QueryTimeout cancels the queries running for longer, if set
+	QueryTimeout time.Duration
+	// StatementTimeout also sets the session's statement_timeout to QueryTimeout, for the server to cancel the queries
+	StatementTimeout bool
+	// ReconnectTimeout bounds the time spent reconnecting after a connection loss, unlimited if zero
+	ReconnectTimeout time.Duration
+	// Fetch reads the rows returned by the queries instead of discarding them
+	Fetch bool
+	// Protocol used to send the queries, defaults to ProtocolPrepared
+	Protocol string
+	// BatchSize is the maximum number of queries sent per round-trip in pipeline mode
+	BatchSize int
+	// Target is the index of the database the worker connects to, tagging its results
+	Target int
+}
+
+// RunQueries executes database queries sequentially on a dedicated connection and reports latency and errors.
+// Latency is measured client-side and is impacted by network latency. In pipeline mode, the queries available
+// in the input are sent in batches, the latency of each query being measured until its result is received.
+// When the context is cancelled, the in-flight queries are aborted and not reported, and the connection is closed.
+func RunQueries(ctx context.Context, index int, connect ConnectFunc, statements []*Statement, opts Options, input <-chan *Query, output chan<- stats.Result) error {
+	s, err := newDedicatedSession(ctx, index, connect, statements, opts, output)
 	if err != nil {
 		return err
 	}
-	if _, err = conn.Prepare(ctx, TimeBucketQueryName, TimeBucketQueryText); err != nil {
-		return err
+	return run(ctx, index, s, opts, input, output)
+}
+
+// RunPooledQueries executes database queries like RunQueries, acquiring a connection from a shared pool
+// for each query. The time spent waiting for a connection is reported separately from the query latency.
+func RunPooledQueries(ctx context.Context, index int, acquire AcquireFunc, statements []*Statement, opts Options, input <-chan *Query, output chan<- stats.Result) error {
+	return run(ctx, index, &pooledSession{acquireConn: acquire, statements: statements}, opts, input, output)
+}
+
+// run executes the queries received from the input on the connections of the session, until the input is closed.
+func run(ctx context.Context, index int, s session, opts Options, input <-chan *Query, output chan<- stats.Result) error {
+	batchSize := 1
+	if opts.Protocol == ProtocolPipeline && opts.BatchSize > 1 {
+		batchSize = opts.BatchSize
 	}
 
-	for query := range input {
+	for {
+		queries, ok := receive(ctx, input, batchSize)
+		if !ok {
+			return s.close()
+		}
+		received := time.Now()
+
+		conn, prepared, wait, err := s.acquire(ctx)
+		if ctx.Err() != nil {
+			if err == nil {
+				_ = s.release(ctx, nil, time.Now())
+			}
+			return s.close()
+		}
+		if err != nil {
+			for _, query := range queries {
+				output <- stats.Result{
+					Worker:      index,
+					Target:      opts.Target,
+					Key:         query.Key,
+					Statement:   query.Statement,
+					Warmup:      query.Warmup,
+					Stage:       query.Stage,
+					QueueWait:   queueWait(query, received),
+					AcquireWait: wait,
+					Err:         err,
+				}
+				query.reported()
+			}
+			continue
+		}
+
+		// Reject parameter rows not matching the statement, without sending them to the server
+		valid := queries[:0]
+		for _, query := range queries {
+			if err := validate(prepared[query.Statement], query); err != nil {
+				output <- stats.Result{
+					Worker:    index,
+					Target:    opts.Target,
+					Key:       query.Key,
+					Statement: query.Statement,
+					Warmup:    query.Warmup,
+					Stage:     query.Stage,
+					QueueWait: queueWait(query, received),
+					Err:       err,
+				}
+				query.reported()
+				continue
+			}
+			valid = append(valid, query)
+		}
+		if len(valid) == 0 {
+			if err := s.release(ctx, nil, time.Now()); err != nil {
+				return err
+			}
+			continue
+		}
+
 		start := time.Now()
-		// Execute the query and discard the result without reading it to better reflect the server-side execution time.
-		_, err := conn.Exec(ctx, TimeBucketQueryName, query.Hostname, query.StartTime, query.EndTime)
-		output <- stats.Result{
-			Worker:  index,
-			Latency: time.Since(start),
-			Err:     err,
+		var outcomes []outcome
+		if opts.Protocol == ProtocolPipeline {
+			outcomes = execBatch(ctx, conn, opts, valid)
+		} else {
+			f, err := exec(ctx, conn, opts, valid[0], prepared[valid[0].Statement])
+			outcomes = []outcome{{end: time.Now(), fetched: f, err: err}}
+		}
+		if ctx.Err() != nil {
+			// Interrupted queries did not fail, do not report them
+			_ = s.release(ctx, nil, time.Now())
+			return s.close()
+		}
+
+		var failed error
+		for i, query := range valid {
+			o := outcomes[i]
+			result := stats.Result{
+				Worker:      index,
+				Target:      opts.Target,
+				Key:         query.Key,
+				Statement:   query.Statement,
+				Warmup:      query.Warmup,
+				Stage:       query.Stage,
+				Latency:     o.end.Sub(start),
+				QueueWait:   queueWait(query, received),
+				AcquireWait: wait,
+				Timeout:     timedOut(o.err, opts),
+				Err:         o.err,
+			}
+			// Measure from the intended start time to account for the queries delayed by slow ones
+			if !query.Scheduled.IsZero() {
+				result.CorrectedLatency = o.end.Sub(query.Scheduled)
+			}
+			if o.fetched != nil && o.err == nil {
+				result.Rows = o.fetched.rows
+				result.Bytes = o.fetched.bytes
+				result.FirstRow = result.Latency
+				if o.fetched.rows > 0 {
+					result.FirstRow = o.fetched.firstRow.Sub(start)
+				}
+			}
+			if o.err != nil {
+				failed = o.err
+			}
+			output <- result
+			query.reported()
 		}
+
+		if err := s.release(ctx, failed, outcomes[len(outcomes)-1].end); err != nil {
+			return err
+		}
+	}
+}
+
+// queueWait returns the time the query spent in the client-side queues until the worker received it.
+func queueWait(q *Query, received time.Time) time.Duration {
+	if q.Enqueued.IsZero() {
+		return 0
+	}
+	return received.Sub(q.Enqueued)
+}
+
+// receive waits for the next query, then takes the queries already available in the input, up to max.
+// It returns false if the context is cancelled or the input is closed before a query is received.
+func receive(ctx context.Context, input <-chan *Query, max int) ([]*Query, bool) {
+	var queries []*Query
+	select {
+	case <-ctx.Done():
+		return nil, false
+	case q, ok := <-input:
+		if !ok {
+			return nil, false
+		}
+		queries = append(queries, q)
 	}
+	for len(queries) < max {
+		select {
+		case q, ok := <-input:
+			if !ok {
+				return queries, true
+			}
+			queries = append(queries, q)
+		default:
+			return queries, true
+		}
+	}
+	return queries, true
+}
 
+// reopen opens a new connection after a connection loss, retrying with an exponential backoff
+// until the reconnect timeout is elapsed.
+func reopen(ctx context.Context, connect ConnectFunc, statements []*Statement, opts Options) (Conn, map[string]*pgconn.StatementDescription, error) {
+	if opts.ReconnectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.ReconnectTimeout)
+		defer cancel()
+	}
+	var conn Conn
+	var prepared map[string]*pgconn.StatementDescription
+	err := retry(ctx, backoff, func() error {
+		var err error
+		conn, prepared, err = open(ctx, connect, statements, opts)
+		return err
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot reconnect: %w", err)
+	}
+	return conn, prepared, nil
+}
+
+// open connects to the database, sets the session parameters and prepares the statements.
+func open(ctx context.Context, connect ConnectFunc, statements []*Statement, opts Options) (Conn, map[string]*pgconn.StatementDescription, error) {
+	conn, err := connect(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := ConfigureSession(ctx, conn, opts); err != nil {
+		_ = closeConn(conn)
+		return nil, nil, err
+	}
+	prepared, err := prepare(ctx, conn, statements)
+	if err != nil {
+		_ = closeConn(conn)
+		return nil, nil, err
+	}
+	return conn, prepared, nil
+}
+
+// ConfigureSession sets the session parameters of a new connection: the statement_timeout if enabled.
+func ConfigureSession(ctx context.Context, conn Conn, opts Options) error {
+	if opts.QueryTimeout > 0 && opts.StatementTimeout {
+		if _, err := conn.Exec(ctx, fmt.Sprintf("SET statement_timeout = %d", opts.QueryTimeout.Milliseconds())); err != nil {
+			return fmt.Errorf("cannot set statement_timeout: %w", err)
+		}
+	}
+	return nil
+}
+
+// prepare prepares the statements on the connection, and returns their descriptions by name.
+func prepare(ctx context.Context, conn Conn, statements []*Statement) (map[string]*pgconn.StatementDescription, error) {
+	prepared := make(map[string]*pgconn.StatementDescription, len(statements))
+	for _, stmt := range statements {
+		sd, err := conn.Prepare(ctx, stmt.Name, stmt.Text)
+		if err != nil {
+			return nil, fmt.Errorf("cannot prepare statement %s: %w", stmt.Name, err)
+		}
+		prepared[stmt.Name] = sd
+	}
+	return prepared, nil
+}
+
+// fetched holds the rows read by a query in fetch mode, and when the first one was received.
+type fetched struct {
+	rows     uint64
+	bytes    uint64
+	firstRow time.Time
+}
+
+// outcome holds the result of a query, and when it was received.
+type outcome struct {
+	end     time.Time
+	fetched *fetched
+	err     error
+}
+
+// exec executes a query with the selected protocol. By default, the result is discarded without reading it to better
+// reflect the server-side execution time, in fetch mode the rows are read and returned.
+// The query is cancelled if it runs longer than the query timeout.
+func exec(ctx context.Context, conn Conn, opts Options, query *Query, sd *pgconn.StatementDescription) (*fetched, error) {
+	ctx, cancel := withTimeout(ctx, opts)
+	defer cancel()
+	sql, args := command(opts, query, sd)
+	if opts.Fetch {
+		return readRows(conn.Query(ctx, sql, args...))
+	}
+	_, err := conn.Exec(ctx, sql, args...)
+	return nil, err
+}
+
+// execBatch sends the queries in a single batch, using their prepared statements, and reads their results in order.
+// The query timeout applies to the whole batch.
+func execBatch(ctx context.Context, conn Conn, opts Options, queries []*Query) []outcome {
+	ctx, cancel := withTimeout(ctx, opts)
+	defer cancel()
+	batch := &pgx.Batch{}
+	for _, query := range queries {
+		batch.Queue(query.Statement, query.Args()...)
+	}
+	results := conn.SendBatch(ctx, batch)
+	outcomes := make([]outcome, len(queries))
+	for i := range queries {
+		var f *fetched
+		var err error
+		if opts.Fetch {
+			f, err = readRows(results.Query())
+		} else {
+			_, err = results.Exec()
+		}
+		outcomes[i] = outcome{end: time.Now(), fetched: f, err: err}
+	}
+	// Errors are already returned for the queries they occurred on
+	_ = results.Close()
+	return outcomes
+}
+
+// command returns the SQL and arguments to send for a query: the name of its prepared statement,
+// or its text for the simple and extended protocols.
+func command(opts Options, query *Query, sd *pgconn.StatementDescription) (string, []interface{}) {
+	switch opts.Protocol {
+	case ProtocolSimple:
+		return sd.SQL, append([]interface{}{pgx.QuerySimpleProtocol(true)}, query.Args()...)
+	case ProtocolExtended:
+		return sd.SQL, query.Args()
+	default:
+		return query.Statement, query.Args()
+	}
+}
+
+// withTimeout returns a context cancelled after the query timeout, if set.
+func withTimeout(ctx context.Context, opts Options) (context.Context, context.CancelFunc) {
+	if opts.QueryTimeout == 0 {
+		return ctx, func() {}
+	}
+	timeout := opts.QueryTimeout
+	if opts.StatementTimeout {
+		timeout += statementTimeoutGrace
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// readRows reads all the rows of a query, counting the size of their raw values.
+func readRows(rows pgx.Rows, err error) (*fetched, error) {
+	if err != nil {
+		return nil, err
+	}
+	f := &fetched{}
+	for rows.Next() {
+		if f.rows == 0 {
+			f.firstRow = time.Now()
+		}
+		f.rows++
+		for _, v := range rows.RawValues() {
+			f.bytes += uint64(len(v))
+		}
+	}
+	rows.Close()
+	return f, rows.Err()
+}
+
+// timedOut returns whether a query failed because of the query timeout, client-side or server-side.
+func timedOut(err error, opts Options) bool {
+	if err == nil || opts.QueryTimeout == 0 {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || pgconn.Timeout(err) {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	return opts.StatementTimeout && errors.As(err, &pgErr) && pgErr.Code == queryCanceledCode
+}
+
+// closeConn closes the connection with its own timeout, so that it is closed gracefully even after an interruption.
+func closeConn(conn Conn) error {
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
 	return conn.Close(ctx)
 }
+
+func validate(sd *pgconn.StatementDescription, query *Query) error {
+	if sd == nil {
+		return &stats.InputError{Err: fmt.Errorf("unknown statement %s", query.Statement)}
+	}
+	if len(query.Params) != len(sd.ParamOIDs) {
+		return &stats.InputError{Err: fmt.Errorf("statement %s expects %d parameters, got %d", query.Statement, len(sd.ParamOIDs), len(query.Params))}
+	}
+	return nil
+}
@@ -8,6 +8,8 @@ import (
 
 	"github.com/golang/mock/gomock"
 	"github.com/jackc/pgconn"
+	"github.com/jackc/pgproto3/v2"
+	"github.com/jackc/pgx/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/xvello/pgbench/internal/db/mock"
@@ -16,25 +18,22 @@ import (
 
 func TestRunQueries(t *testing.T) {
 	cases := []struct {
-		Hostname     string
-		StartTime    string
-		EndTime      string
+		Params       []string
 		QueryError   error
 		QueryLatency time.Duration
+		SkipExec     bool
 	}{{
-		Hostname:     "host_000008",
-		StartTime:    "2017-01-01 08:59:22",
-		EndTime:      "2017-01-01 09:59:22",
+		Params:       []string{"host_000008", "2017-01-01 08:59:22", "2017-01-01 09:59:22"},
 		QueryLatency: time.Duration(5) * time.Millisecond,
 	}, {
-		Hostname:   "host_000001",
-		StartTime:  "A",
-		EndTime:    "B",
+		Params:     []string{"host_000001", "A", "B"},
 		QueryError: fmt.Errorf("bad input"),
 	}, {
-		Hostname:     "host_000003",
-		StartTime:    "2017-01-01 04:30:52",
-		EndTime:      "2017-01-01 05:30:52",
+		Params:     []string{"host_000001", "2017-01-01 04:30:52"},
+		QueryError: fmt.Errorf("statement cpu-buckets expects 3 parameters, got 2"),
+		SkipExec:   true,
+	}, {
+		Params:       []string{"host_000003", "2017-01-01 04:30:52", "2017-01-01 05:30:52"},
 		QueryLatency: time.Duration(2) * time.Millisecond,
 	}}
 
@@ -42,20 +41,27 @@ func TestRunQueries(t *testing.T) {
 	conn := mock.NewMockConn(c)
 	conn.EXPECT().
 		Prepare(gomock.Any(), TimeBucketQueryName, TimeBucketQueryText).
-		Return(&pgconn.StatementDescription{}, nil)
+		Return(&pgconn.StatementDescription{ParamOIDs: []uint32{25, 1114, 1114}}, nil)
 	conn.EXPECT().
 		Close(gomock.Any()).
 		Return(nil)
 
 	for _, c := range cases {
-		if c.QueryError != nil {
+		args := (&Query{Params: c.Params}).Args()
+		switch {
+		case c.SkipExec:
+			continue
+		case c.QueryError != nil:
 			conn.EXPECT().
-				Exec(gomock.Any(), TimeBucketQueryName, c.Hostname, c.StartTime, c.EndTime).
+				Exec(gomock.Any(), TimeBucketQueryName, args...).
 				Return(nil, c.QueryError)
-		} else {
+			conn.EXPECT().
+				IsClosed().
+				Return(false)
+		default:
 			latency := c.QueryLatency
 			conn.EXPECT().
-				Exec(gomock.Any(), TimeBucketQueryName, c.Hostname, c.StartTime, c.EndTime).
+				Exec(gomock.Any(), TimeBucketQueryName, args...).
 				DoAndReturn(func(_ context.Context, _ string, _ ...interface{}) (pgconn.CommandTag, error) {
 					time.Sleep(latency)
 					return nil, nil
@@ -64,25 +70,22 @@ func TestRunQueries(t *testing.T) {
 	}
 
 	queryChan := make(chan *Query)
-	resultChan := make(chan stats.Result, 3)
+	resultChan := make(chan stats.Result, len(cases))
 	go func() {
 		for _, c := range cases {
-			queryChan <- &Query{
-				Hostname:  c.Hostname,
-				StartTime: c.StartTime,
-				EndTime:   c.EndTime,
-			}
+			queryChan <- &Query{Statement: TimeBucketQueryName, Params: c.Params}
 		}
 		close(queryChan)
 	}()
 
 	assert.NoError(t, RunQueries(context.Background(), 2, func(ctx context.Context) (Conn, error) {
 		return conn, nil
-	}, queryChan, resultChan))
+	}, []*Statement{DefaultStatement()}, Options{}, queryChan, resultChan))
 
 	for _, c := range cases {
 		r, ok := <-resultChan
 		require.True(t, ok, "missing expected result")
+		assert.Equal(t, TimeBucketQueryName, r.Statement)
 		if c.QueryError != nil {
 			assert.EqualError(t, r.Err, c.QueryError.Error())
 		} else {
@@ -91,3 +94,572 @@ func TestRunQueries(t *testing.T) {
 		}
 	}
 }
+
+func TestRunQueries_Statements(t *testing.T) {
+	statements := []*Statement{
+		DefaultStatement(),
+		{Name: "last-point", Text: "SELECT * FROM cpu_usage WHERE host = $1 ORDER BY ts DESC LIMIT 1"},
+	}
+
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+	conn.EXPECT().
+		Prepare(gomock.Any(), TimeBucketQueryName, TimeBucketQueryText).
+		Return(&pgconn.StatementDescription{ParamOIDs: []uint32{25, 1114, 1114}}, nil)
+	conn.EXPECT().
+		Prepare(gomock.Any(), "last-point", statements[1].Text).
+		Return(&pgconn.StatementDescription{ParamOIDs: []uint32{25}}, nil)
+	conn.EXPECT().
+		Exec(gomock.Any(), "last-point", "host_000008").
+		Return(pgconn.CommandTag{}, nil)
+	conn.EXPECT().
+		Close(gomock.Any()).
+		Return(nil)
+
+	queryChan := make(chan *Query, 2)
+	resultChan := make(chan stats.Result, 2)
+	queryChan <- &Query{Statement: "last-point", Params: []string{"host_000008"}}
+	queryChan <- &Query{Statement: "unknown", Params: []string{"host_000008"}}
+	close(queryChan)
+
+	assert.NoError(t, RunQueries(context.Background(), 0, func(ctx context.Context) (Conn, error) {
+		return conn, nil
+	}, statements, Options{}, queryChan, resultChan))
+
+	r := <-resultChan
+	assert.Equal(t, "last-point", r.Statement)
+	assert.NoError(t, r.Err)
+	r = <-resultChan
+	assert.Equal(t, "unknown", r.Statement)
+	assert.EqualError(t, r.Err, "unknown statement unknown")
+	var inputErr *stats.InputError
+	assert.ErrorAs(t, r.Err, &inputErr)
+}
+
+func TestRunQueries_Scheduled(t *testing.T) {
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+	conn.EXPECT().
+		Prepare(gomock.Any(), TimeBucketQueryName, TimeBucketQueryText).
+		Return(&pgconn.StatementDescription{ParamOIDs: []uint32{25, 1114, 1114}}, nil)
+	conn.EXPECT().
+		Exec(gomock.Any(), TimeBucketQueryName, gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, _ ...interface{}) (pgconn.CommandTag, error) {
+			time.Sleep(2 * time.Millisecond)
+			return nil, nil
+		}).
+		Times(2)
+	conn.EXPECT().
+		Close(gomock.Any()).
+		Return(nil)
+
+	queryChan := make(chan *Query, 2)
+	resultChan := make(chan stats.Result, 2)
+	params := []string{"host_000008", "2017-01-01 08:59:22", "2017-01-01 09:59:22"}
+	// The query was intended to start 10ms ago
+	queryChan <- &Query{Statement: TimeBucketQueryName, Params: params, Scheduled: time.Now().Add(-10 * time.Millisecond)}
+	queryChan <- &Query{Statement: TimeBucketQueryName, Params: params}
+	close(queryChan)
+
+	assert.NoError(t, RunQueries(context.Background(), 0, func(ctx context.Context) (Conn, error) {
+		return conn, nil
+	}, []*Statement{DefaultStatement()}, Options{}, queryChan, resultChan))
+
+	r := <-resultChan
+	assert.InDelta(t, (2 * time.Millisecond).Seconds(), r.Latency.Seconds(), time.Millisecond.Seconds())
+	assert.GreaterOrEqual(t, r.CorrectedLatency, 12*time.Millisecond)
+	r = <-resultChan
+	assert.Zero(t, r.CorrectedLatency)
+}
+
+func TestRunQueries_QueueWait(t *testing.T) {
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+	conn.EXPECT().
+		Prepare(gomock.Any(), TimeBucketQueryName, TimeBucketQueryText).
+		Return(&pgconn.StatementDescription{ParamOIDs: []uint32{25, 1114, 1114}}, nil)
+	conn.EXPECT().
+		Exec(gomock.Any(), TimeBucketQueryName, gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, _ ...interface{}) (pgconn.CommandTag, error) {
+			time.Sleep(2 * time.Millisecond)
+			return nil, nil
+		}).
+		Times(3)
+	conn.EXPECT().
+		Close(gomock.Any()).
+		Return(nil)
+
+	queryChan := make(chan *Query, 3)
+	resultChan := make(chan stats.Result, 3)
+	params := []string{"host_000008", "2017-01-01 08:59:22", "2017-01-01 09:59:22"}
+	// The first query was queued 10ms ago, the second one waits for the first to complete
+	now := time.Now()
+	queryChan <- &Query{Statement: TimeBucketQueryName, Params: params, Enqueued: now.Add(-10 * time.Millisecond)}
+	queryChan <- &Query{Statement: TimeBucketQueryName, Params: params, Enqueued: now}
+	queryChan <- &Query{Statement: TimeBucketQueryName, Params: params}
+	close(queryChan)
+
+	assert.NoError(t, RunQueries(context.Background(), 0, func(ctx context.Context) (Conn, error) {
+		return conn, nil
+	}, []*Statement{DefaultStatement()}, Options{}, queryChan, resultChan))
+
+	r := <-resultChan
+	assert.GreaterOrEqual(t, r.QueueWait, 10*time.Millisecond)
+	assert.Less(t, r.Latency, r.QueueWait)
+	r = <-resultChan
+	assert.GreaterOrEqual(t, r.QueueWait, 2*time.Millisecond)
+	r = <-resultChan
+	assert.Zero(t, r.QueueWait)
+}
+
+func TestRunQueries_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+	conn.EXPECT().
+		Prepare(gomock.Any(), TimeBucketQueryName, TimeBucketQueryText).
+		Return(&pgconn.StatementDescription{ParamOIDs: []uint32{25, 1114, 1114}}, nil)
+	conn.EXPECT().
+		Exec(gomock.Any(), TimeBucketQueryName, gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, _ string, _ ...interface{}) (pgconn.CommandTag, error) {
+			// Interrupt the benchmark while the query is running
+			cancel()
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+	conn.EXPECT().
+		Close(gomock.Any()).
+		DoAndReturn(func(ctx context.Context) error {
+			// The connection is closed with a live context
+			return ctx.Err()
+		})
+
+	// The pending queries are not executed
+	queryChan := make(chan *Query, 3)
+	resultChan := make(chan stats.Result, 3)
+	params := []string{"host_000008", "2017-01-01 08:59:22", "2017-01-01 09:59:22"}
+	for i := 0; i < 3; i++ {
+		queryChan <- &Query{Statement: TimeBucketQueryName, Params: params}
+	}
+
+	assert.NoError(t, RunQueries(ctx, 0, func(ctx context.Context) (Conn, error) {
+		return conn, nil
+	}, []*Statement{DefaultStatement()}, Options{}, queryChan, resultChan))
+	assert.Empty(t, resultChan, "interrupted queries must not be reported")
+}
+
+func TestRunQueries_Timeout(t *testing.T) {
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+	connectCount := 0
+	params := []string{"host_000008", "2017-01-01 08:59:22", "2017-01-01 09:59:22"}
+
+	// The connection is closed when the first query times out, the worker reconnects for the second one
+	conn.EXPECT().
+		Prepare(gomock.Any(), TimeBucketQueryName, TimeBucketQueryText).
+		Return(&pgconn.StatementDescription{ParamOIDs: []uint32{25, 1114, 1114}}, nil).
+		Times(2)
+	gomock.InOrder(
+		conn.EXPECT().
+			Exec(gomock.Any(), TimeBucketQueryName, gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(ctx context.Context, _ string, _ ...interface{}) (pgconn.CommandTag, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}),
+		conn.EXPECT().
+			IsClosed().
+			Return(true),
+		conn.EXPECT().
+			Exec(gomock.Any(), TimeBucketQueryName, gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(pgconn.CommandTag{}, nil),
+	)
+	conn.EXPECT().
+		Close(gomock.Any()).
+		Return(nil)
+
+	queryChan := make(chan *Query, 2)
+	resultChan := make(chan stats.Result, 3)
+	queryChan <- &Query{Statement: TimeBucketQueryName, Params: params}
+	queryChan <- &Query{Statement: TimeBucketQueryName, Params: params}
+	close(queryChan)
+
+	assert.NoError(t, RunQueries(context.Background(), 0, func(ctx context.Context) (Conn, error) {
+		connectCount++
+		return conn, nil
+	}, []*Statement{DefaultStatement()}, Options{QueryTimeout: 5 * time.Millisecond}, queryChan, resultChan))
+	assert.Equal(t, 2, connectCount)
+
+	r := <-resultChan
+	assert.True(t, r.Timeout)
+	assert.ErrorIs(t, r.Err, context.DeadlineExceeded)
+	assert.InDelta(t, (5 * time.Millisecond).Seconds(), r.Latency.Seconds(), (5 * time.Millisecond).Seconds())
+	r = <-resultChan
+	assert.True(t, r.Reconnected)
+	r = <-resultChan
+	assert.False(t, r.Timeout)
+	assert.NoError(t, r.Err)
+}
+
+func TestRunQueries_StatementTimeout(t *testing.T) {
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+	params := []string{"host_000008", "2017-01-01 08:59:22", "2017-01-01 09:59:22"}
+
+	conn.EXPECT().
+		Exec(gomock.Any(), "SET statement_timeout = 500").
+		Return(pgconn.CommandTag{}, nil)
+	conn.EXPECT().
+		Prepare(gomock.Any(), TimeBucketQueryName, TimeBucketQueryText).
+		Return(&pgconn.StatementDescription{ParamOIDs: []uint32{25, 1114, 1114}}, nil)
+	conn.EXPECT().
+		Exec(gomock.Any(), TimeBucketQueryName, gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, _ string, _ ...interface{}) (pgconn.CommandTag, error) {
+			// The client-side timeout leaves time for the server to cancel the query
+			deadline, ok := ctx.Deadline()
+			assert.True(t, ok)
+			assert.Greater(t, time.Until(deadline), time.Second)
+			return nil, &pgconn.PgError{Code: "57014", Message: "canceling statement due to statement timeout"}
+		})
+	conn.EXPECT().
+		IsClosed().
+		Return(false)
+	conn.EXPECT().
+		Close(gomock.Any()).
+		Return(nil)
+
+	queryChan := make(chan *Query, 1)
+	resultChan := make(chan stats.Result, 1)
+	queryChan <- &Query{Statement: TimeBucketQueryName, Params: params}
+	close(queryChan)
+
+	assert.NoError(t, RunQueries(context.Background(), 0, func(ctx context.Context) (Conn, error) {
+		return conn, nil
+	}, []*Statement{DefaultStatement()}, Options{QueryTimeout: 500 * time.Millisecond, StatementTimeout: true}, queryChan, resultChan))
+
+	r := <-resultChan
+	assert.True(t, r.Timeout)
+	assert.Error(t, r.Err)
+}
+
+func TestRunQueries_Reconnect(t *testing.T) {
+	reconnectMinWait = time.Millisecond
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+	connectCount := 0
+	params := []string{"host_000008", "2017-01-01 08:59:22", "2017-01-01 09:59:22"}
+
+	// The connection is lost during the first query, the server is unavailable for two connection attempts
+	conn.EXPECT().
+		Prepare(gomock.Any(), TimeBucketQueryName, TimeBucketQueryText).
+		Return(&pgconn.StatementDescription{ParamOIDs: []uint32{25, 1114, 1114}}, nil).
+		Times(2)
+	gomock.InOrder(
+		conn.EXPECT().
+			Exec(gomock.Any(), TimeBucketQueryName, gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(nil, fmt.Errorf("unexpected EOF")),
+		conn.EXPECT().
+			IsClosed().
+			Return(true),
+		conn.EXPECT().
+			Exec(gomock.Any(), TimeBucketQueryName, gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(pgconn.CommandTag{}, nil),
+	)
+	conn.EXPECT().
+		Close(gomock.Any()).
+		Return(nil)
+
+	queryChan := make(chan *Query, 2)
+	resultChan := make(chan stats.Result, 3)
+	queryChan <- &Query{Statement: TimeBucketQueryName, Params: params}
+	queryChan <- &Query{Statement: TimeBucketQueryName, Params: params}
+	close(queryChan)
+
+	assert.NoError(t, RunQueries(context.Background(), 1, func(ctx context.Context) (Conn, error) {
+		connectCount++
+		if connectCount == 2 || connectCount == 3 {
+			return nil, fmt.Errorf("connection refused")
+		}
+		return conn, nil
+	}, []*Statement{DefaultStatement()}, Options{}, queryChan, resultChan))
+	assert.Equal(t, 4, connectCount)
+
+	r := <-resultChan
+	assert.EqualError(t, r.Err, "unexpected EOF")
+	r = <-resultChan
+	assert.True(t, r.Reconnected)
+	assert.Equal(t, 1, r.Worker)
+	// Waited 1ms then 2ms between the connection attempts
+	assert.GreaterOrEqual(t, r.Disconnected, 3*time.Millisecond)
+	r = <-resultChan
+	assert.False(t, r.Reconnected)
+	assert.NoError(t, r.Err)
+}
+
+func TestRunQueries_ReconnectTimeout(t *testing.T) {
+	reconnectMinWait = time.Millisecond
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+	connected := false
+
+	conn.EXPECT().
+		Prepare(gomock.Any(), TimeBucketQueryName, TimeBucketQueryText).
+		Return(&pgconn.StatementDescription{ParamOIDs: []uint32{25, 1114, 1114}}, nil)
+	conn.EXPECT().
+		Exec(gomock.Any(), TimeBucketQueryName, gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(nil, fmt.Errorf("unexpected EOF"))
+	conn.EXPECT().
+		IsClosed().
+		Return(true)
+
+	queryChan := make(chan *Query, 1)
+	resultChan := make(chan stats.Result, 1)
+	queryChan <- &Query{Statement: TimeBucketQueryName, Params: []string{"host_000008", "2017-01-01 08:59:22", "2017-01-01 09:59:22"}}
+
+	err := RunQueries(context.Background(), 0, func(ctx context.Context) (Conn, error) {
+		if connected {
+			return nil, fmt.Errorf("connection refused")
+		}
+		connected = true
+		return conn, nil
+	}, []*Statement{DefaultStatement()}, Options{ReconnectTimeout: 20 * time.Millisecond}, queryChan, resultChan)
+	assert.EqualError(t, err, "cannot reconnect: connection refused")
+	assert.Len(t, resultChan, 1)
+}
+
+// fakeRows returns a fixed set of rows, waiting before the first one.
+func TestRunPooledQueries(t *testing.T) {
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+	params := []string{"host_000008", "2017-01-01 08:59:22", "2017-01-01 09:59:22"}
+
+	// Statements are prepared on each acquire, pgx returns the cached description
+	conn.EXPECT().
+		Prepare(gomock.Any(), TimeBucketQueryName, TimeBucketQueryText).
+		Return(&pgconn.StatementDescription{ParamOIDs: []uint32{25, 1114, 1114}}, nil).
+		Times(2)
+	conn.EXPECT().
+		Exec(gomock.Any(), TimeBucketQueryName, gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(pgconn.CommandTag{}, nil).
+		Times(2)
+
+	queryChan := make(chan *Query, 3)
+	resultChan := make(chan stats.Result, 3)
+	for i := 0; i < 3; i++ {
+		queryChan <- &Query{Statement: TimeBucketQueryName, Params: params}
+	}
+	close(queryChan)
+
+	// The first acquire waits for a connection, the last one fails
+	acquired, released := 0, 0
+	assert.NoError(t, RunPooledQueries(context.Background(), 1, func(ctx context.Context) (Conn, func(), error) {
+		acquired++
+		switch acquired {
+		case 1:
+			time.Sleep(2 * time.Millisecond)
+		case 3:
+			return nil, nil, fmt.Errorf("pool closed")
+		}
+		return conn, func() { released++ }, nil
+	}, []*Statement{DefaultStatement()}, Options{}, queryChan, resultChan))
+	assert.Equal(t, 2, released)
+
+	r := <-resultChan
+	assert.NoError(t, r.Err)
+	assert.GreaterOrEqual(t, r.AcquireWait, 2*time.Millisecond)
+	r = <-resultChan
+	assert.NoError(t, r.Err)
+	r = <-resultChan
+	assert.EqualError(t, r.Err, "cannot acquire connection: pool closed")
+}
+
+type fakeRows struct {
+	values [][][]byte
+	delay  time.Duration
+	next   int
+}
+
+var _ pgx.Rows = &fakeRows{}
+
+func (r *fakeRows) Close()                                         {}
+func (r *fakeRows) Err() error                                     { return nil }
+func (r *fakeRows) CommandTag() pgconn.CommandTag                  { return nil }
+func (r *fakeRows) FieldDescriptions() []pgproto3.FieldDescription { return nil }
+func (r *fakeRows) Scan(...interface{}) error                      { return nil }
+func (r *fakeRows) Values() ([]interface{}, error)                 { return nil, nil }
+func (r *fakeRows) RawValues() [][]byte                            { return r.values[r.next-1] }
+
+func (r *fakeRows) Next() bool {
+	if r.next == 0 {
+		time.Sleep(r.delay)
+	} else {
+		time.Sleep(time.Millisecond)
+	}
+	r.next++
+	return r.next <= len(r.values)
+}
+
+func TestRunQueries_Fetch(t *testing.T) {
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+	params := []string{"host_000008", "2017-01-01 08:59:22", "2017-01-01 09:59:22"}
+
+	conn.EXPECT().
+		Prepare(gomock.Any(), TimeBucketQueryName, TimeBucketQueryText).
+		Return(&pgconn.StatementDescription{ParamOIDs: []uint32{25, 1114, 1114}}, nil)
+	gomock.InOrder(
+		conn.EXPECT().
+			Query(gomock.Any(), TimeBucketQueryName, gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(&fakeRows{
+				values: [][][]byte{{[]byte("2017-01-01 09:00:00"), []byte("12.5")}, {[]byte("2017-01-01 09:01:00"), []byte("7")}},
+				delay:  5 * time.Millisecond,
+			}, nil),
+		conn.EXPECT().
+			Query(gomock.Any(), TimeBucketQueryName, gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(&fakeRows{}, nil),
+	)
+	conn.EXPECT().
+		Close(gomock.Any()).
+		Return(nil)
+
+	queryChan := make(chan *Query, 2)
+	resultChan := make(chan stats.Result, 2)
+	queryChan <- &Query{Statement: TimeBucketQueryName, Params: params}
+	queryChan <- &Query{Statement: TimeBucketQueryName, Params: params}
+	close(queryChan)
+
+	assert.NoError(t, RunQueries(context.Background(), 0, func(ctx context.Context) (Conn, error) {
+		return conn, nil
+	}, []*Statement{DefaultStatement()}, Options{Fetch: true}, queryChan, resultChan))
+
+	r := <-resultChan
+	assert.NoError(t, r.Err)
+	assert.EqualValues(t, 2, r.Rows)
+	assert.EqualValues(t, 43, r.Bytes)
+	assert.GreaterOrEqual(t, r.FirstRow, 5*time.Millisecond)
+	// Reading the next rows takes longer than the first one
+	assert.GreaterOrEqual(t, r.Latency, r.FirstRow+2*time.Millisecond)
+
+	// Without rows, the time to first row is the time to the end of the query
+	r = <-resultChan
+	assert.Zero(t, r.Rows)
+	assert.Equal(t, r.Latency, r.FirstRow)
+}
+
+func TestRunQueries_Protocols(t *testing.T) {
+	params := []string{"host_000008", "2017-01-01 08:59:22", "2017-01-01 09:59:22"}
+	args := (&Query{Params: params}).Args()
+	cases := map[string][]interface{}{
+		ProtocolPrepared: append([]interface{}{TimeBucketQueryName}, args...),
+		ProtocolExtended: append([]interface{}{TimeBucketQueryText}, args...),
+		ProtocolSimple:   append([]interface{}{TimeBucketQueryText, pgx.QuerySimpleProtocol(true)}, args...),
+	}
+	for protocol, expected := range cases {
+		t.Run(protocol, func(t *testing.T) {
+			c := gomock.NewController(t)
+			conn := mock.NewMockConn(c)
+			conn.EXPECT().
+				Prepare(gomock.Any(), TimeBucketQueryName, TimeBucketQueryText).
+				Return(&pgconn.StatementDescription{Name: TimeBucketQueryName, SQL: TimeBucketQueryText, ParamOIDs: []uint32{25, 1114, 1114}}, nil)
+			conn.EXPECT().
+				Exec(gomock.Any(), expected[0], expected[1:]...).
+				Return(pgconn.CommandTag{}, nil)
+			conn.EXPECT().
+				Close(gomock.Any()).
+				Return(nil)
+
+			queryChan := make(chan *Query, 1)
+			resultChan := make(chan stats.Result, 1)
+			queryChan <- &Query{Statement: TimeBucketQueryName, Params: params}
+			close(queryChan)
+
+			assert.NoError(t, RunQueries(context.Background(), 0, func(ctx context.Context) (Conn, error) {
+				return conn, nil
+			}, []*Statement{DefaultStatement()}, Options{Protocol: protocol}, queryChan, resultChan))
+			assert.NoError(t, (<-resultChan).Err)
+		})
+	}
+}
+
+// fakeBatchResults returns the given errors for the queries of a batch, waiting before each result.
+type fakeBatchResults struct {
+	errors []error
+	delay  time.Duration
+	next   int
+}
+
+var _ pgx.BatchResults = &fakeBatchResults{}
+
+func (b *fakeBatchResults) Query() (pgx.Rows, error) { return nil, nil }
+func (b *fakeBatchResults) QueryRow() pgx.Row        { return nil }
+func (b *fakeBatchResults) Close() error             { return nil }
+
+func (b *fakeBatchResults) QueryFunc([]interface{}, func(pgx.QueryFuncRow) error) (pgconn.CommandTag, error) {
+	return nil, nil
+}
+
+func (b *fakeBatchResults) Exec() (pgconn.CommandTag, error) {
+	time.Sleep(b.delay)
+	b.next++
+	return pgconn.CommandTag{}, b.errors[b.next-1]
+}
+
+func TestRunQueries_Pipeline(t *testing.T) {
+	c := gomock.NewController(t)
+	conn := mock.NewMockConn(c)
+	params := []string{"host_000008", "2017-01-01 08:59:22", "2017-01-01 09:59:22"}
+
+	conn.EXPECT().
+		Prepare(gomock.Any(), TimeBucketQueryName, TimeBucketQueryText).
+		Return(&pgconn.StatementDescription{ParamOIDs: []uint32{25, 1114, 1114}}, nil)
+	// The five valid queries are sent in two batches, the invalid one is skipped
+	gomock.InOrder(
+		conn.EXPECT().
+			SendBatch(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, b *pgx.Batch) pgx.BatchResults {
+				assert.Equal(t, 3, b.Len())
+				return &fakeBatchResults{errors: []error{nil, fmt.Errorf("bad input"), nil}, delay: 2 * time.Millisecond}
+			}),
+		conn.EXPECT().
+			IsClosed().
+			Return(false),
+		conn.EXPECT().
+			SendBatch(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, b *pgx.Batch) pgx.BatchResults {
+				assert.Equal(t, 2, b.Len())
+				return &fakeBatchResults{errors: []error{nil, nil}}
+			}),
+	)
+	conn.EXPECT().
+		Close(gomock.Any()).
+		Return(nil)
+
+	queryChan := make(chan *Query, 6)
+	resultChan := make(chan stats.Result, 6)
+	for i := 0; i < 6; i++ {
+		if i == 1 {
+			queryChan <- &Query{Statement: TimeBucketQueryName, Params: params[:1]}
+			continue
+		}
+		queryChan <- &Query{Statement: TimeBucketQueryName, Params: params}
+	}
+	close(queryChan)
+
+	assert.NoError(t, RunQueries(context.Background(), 0, func(ctx context.Context) (Conn, error) {
+		return conn, nil
+	}, []*Statement{DefaultStatement()}, Options{Protocol: ProtocolPipeline, BatchSize: 4}, queryChan, resultChan))
+
+	r := <-resultChan
+	assert.EqualError(t, r.Err, "statement cpu-buckets expects 3 parameters, got 1")
+	// Queries of a batch are measured until their own result is received
+	r = <-resultChan
+	assert.NoError(t, r.Err)
+	first := r.Latency
+	assert.GreaterOrEqual(t, first, 2*time.Millisecond)
+	r = <-resultChan
+	assert.EqualError(t, r.Err, "bad input")
+	r = <-resultChan
+	assert.NoError(t, r.Err)
+	assert.GreaterOrEqual(t, r.Latency, 6*time.Millisecond)
+	assert.Greater(t, r.Latency, first)
+	assert.Len(t, resultChan, 2)
+}
@@ -0,0 +1,71 @@
+package stats
+
+import "fmt"
+
+// DefaultErrorWindow is the default number of queries the error rate is evaluated over.
+const DefaultErrorWindow = 1000
+
+// abortChecker tracks the failed queries against the abort thresholds: a total error count,
+// and an error rate over a sliding window of the most recent queries.
+type abortChecker struct {
+	maxErrors    uint64
+	maxErrorRate float64
+	errors       uint64
+	window       []bool // Whether each query of the window failed, used as a ring buffer
+	next         int
+	full         bool
+	windowErrors int
+}
+
+// newAbortChecker returns a checker for the thresholds set in the options, or nil if none is set.
+func newAbortChecker(opts Options) *abortChecker {
+	if opts.MaxErrors == 0 && opts.MaxErrorRate == 0 {
+		return nil
+	}
+	a := &abortChecker{
+		maxErrors:    opts.MaxErrors,
+		maxErrorRate: opts.MaxErrorRate,
+	}
+	if opts.MaxErrorRate > 0 {
+		size := opts.ErrorWindow
+		if size < 1 {
+			size = DefaultErrorWindow
+		}
+		a.window = make([]bool, size)
+	}
+	return a
+}
+
+// add records a query, and returns the reason to abort the run if it crosses a threshold.
+// The error rate is only evaluated once the window is full, to ignore the first queries.
+func (a *abortChecker) add(failed bool) string {
+	if failed {
+		a.errors++
+	}
+	if a.maxErrors > 0 && a.errors > a.maxErrors {
+		return fmt.Sprintf("%d failed queries, more than the maximum of %d", a.errors, a.maxErrors)
+	}
+	if a.window == nil {
+		return ""
+	}
+
+	if a.window[a.next] {
+		a.windowErrors--
+	}
+	a.window[a.next] = failed
+	if failed {
+		a.windowErrors++
+	}
+	a.next = (a.next + 1) % len(a.window)
+	if a.next == 0 {
+		a.full = true
+	}
+	if !a.full {
+		return ""
+	}
+	rate := 100 * float64(a.windowErrors) / float64(len(a.window))
+	if rate > a.maxErrorRate {
+		return fmt.Sprintf("%.1f%% error rate over the last %d queries, more than the maximum of %g%%", rate, len(a.window), a.maxErrorRate)
+	}
+	return ""
+}
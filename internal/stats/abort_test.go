@@ -0,0 +1,62 @@
+package stats
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAbortChecker_MaxErrors(t *testing.T) {
+	assert.Nil(t, newAbortChecker(Options{}))
+
+	a := newAbortChecker(Options{MaxErrors: 2})
+	assert.Empty(t, a.add(true))
+	assert.Empty(t, a.add(false))
+	assert.Empty(t, a.add(true))
+	assert.Equal(t, "3 failed queries, more than the maximum of 2", a.add(true))
+}
+
+func TestAbortChecker_MaxErrorRate(t *testing.T) {
+	a := newAbortChecker(Options{MaxErrorRate: 25, ErrorWindow: 4})
+
+	// The rate is not evaluated until the window is full
+	assert.Empty(t, a.add(true))
+	assert.Empty(t, a.add(false))
+	assert.Empty(t, a.add(false))
+	assert.Empty(t, a.add(false))
+
+	// The first error slides out of the window
+	assert.Empty(t, a.add(false))
+	assert.Empty(t, a.add(true))
+	assert.Equal(t, "50.0% error rate over the last 4 queries, more than the maximum of 25%", a.add(true))
+}
+
+func TestReadResults_Abort(t *testing.T) {
+	aborted := 0
+	resultChan := make(chan Result, 4)
+	resultChan <- Result{Latency: time.Millisecond}
+	resultChan <- Result{Err: fmt.Errorf("one error")}
+	resultChan <- Result{Err: fmt.Errorf("another error")}
+	// Results received after the abort are still counted
+	resultChan <- Result{Err: fmt.Errorf("late error")}
+	close(resultChan)
+
+	report := ReadResults(1, resultChan, Options{MaxErrors: 1, Abort: func() { aborted++ }})
+	assert.Equal(t, 1, aborted)
+	assert.Equal(t, "2 failed queries, more than the maximum of 1", report.Aborted)
+	assert.EqualValues(t, 3, report.QueriesErr)
+
+	buffer := strings.Builder{}
+	assert.NoError(t, report.Print(&buffer, false))
+	assert.True(t, strings.HasPrefix(buffer.String(), `
+Benchmark aborted: 2 failed queries, more than the maximum of 1, partial results:
+
+Benchmark duration:`), buffer.String())
+
+	buffer.Reset()
+	assert.NoError(t, report.Print(&buffer, true))
+	assert.Contains(t, buffer.String(), `"aborted": "2 failed queries, more than the maximum of 1"`)
+}
@@ -0,0 +1,105 @@
+package stats
+
+import "time"
+
+// DatabaseCounters holds the cumulative counters of the current database in pg_stat_database and of the
+// checkpoints in pg_stat_bgwriter or pg_stat_checkpointer, with the current wait events of the active backends in
+// pg_stat_activity and the number of lock requests waiting in pg_locks. BuffersBackend is nil if the server does not
+// report it, since PostgreSQL 17.
+type DatabaseCounters struct {
+	Commits              uint64
+	Rollbacks            uint64
+	BlocksRead           uint64
+	BlocksHit            uint64
+	TempBytes            uint64
+	Deadlocks            uint64
+	CheckpointsTimed     uint64
+	CheckpointsRequested uint64
+	BuffersCheckpoint    uint64
+	BuffersBackend       *uint64
+	WaitEvents           map[string]int
+	LockWaits            int
+}
+
+// DatabaseSample holds the database activity during one polling interval: the increase of the counters, and the
+// wait events and lock waits at its end. Time is the end of the interval since the start of the benchmark,
+// durations are in milliseconds. CacheHitRatio is the percentage of the blocks found in the shared buffers.
+// BuffersBackend is null if the server does not report it.
+type DatabaseSample struct {
+	Time              float64        `json:"time"`
+	Duration          float64        `json:"duration"`
+	Commits           uint64         `json:"xact_commit"`
+	Rollbacks         uint64         `json:"xact_rollback"`
+	BlocksRead        uint64         `json:"blks_read"`
+	BlocksHit         uint64         `json:"blks_hit"`
+	CacheHitRatio     float64        `json:"cache_hit_ratio"`
+	TempBytes         uint64         `json:"temp_bytes"`
+	Deadlocks         uint64         `json:"deadlocks"`
+	Checkpoints       uint64         `json:"checkpoints"`
+	BuffersCheckpoint uint64         `json:"buffers_checkpoint"`
+	BuffersBackend    *uint64        `json:"buffers_backend"`
+	WaitEvents        map[string]int `json:"wait_events,omitempty"`
+	LockWaits         int            `json:"lock_waits"`
+}
+
+// NewDatabaseSample returns the activity between two readings of the counters.
+func NewDatabaseSample(elapsed, duration time.Duration, before, after DatabaseCounters) *DatabaseSample {
+	s := &DatabaseSample{
+		Time:              durationToMs(elapsed),
+		Duration:          durationToMs(duration),
+		Commits:           sub(after.Commits, before.Commits),
+		Rollbacks:         sub(after.Rollbacks, before.Rollbacks),
+		BlocksRead:        sub(after.BlocksRead, before.BlocksRead),
+		BlocksHit:         sub(after.BlocksHit, before.BlocksHit),
+		TempBytes:         sub(after.TempBytes, before.TempBytes),
+		Deadlocks:         sub(after.Deadlocks, before.Deadlocks),
+		Checkpoints:       sub(after.CheckpointsTimed+after.CheckpointsRequested, before.CheckpointsTimed+before.CheckpointsRequested),
+		BuffersCheckpoint: sub(after.BuffersCheckpoint, before.BuffersCheckpoint),
+		WaitEvents:        after.WaitEvents,
+		LockWaits:         after.LockWaits,
+	}
+	if before.BuffersBackend != nil && after.BuffersBackend != nil {
+		buffers := sub(*after.BuffersBackend, *before.BuffersBackend)
+		s.BuffersBackend = &buffers
+	}
+	if s.BlocksHit+s.BlocksRead > 0 {
+		s.CacheHitRatio = 100 * float64(s.BlocksHit) / float64(s.BlocksHit+s.BlocksRead)
+	} else {
+		s.CacheHitRatio = 100
+	}
+	return s
+}
+
+// DatabaseSamples is the time series of the database activity during the run.
+type DatabaseSamples []*DatabaseSample
+
+// Checkpoints returns the number of checkpoints started during the run.
+func (d DatabaseSamples) Checkpoints() uint64 {
+	var count uint64
+	for _, s := range d {
+		count += s.Checkpoints
+	}
+	return count
+}
+
+// MaxLockWaits returns the highest number of lock requests waiting at the end of an interval.
+func (d DatabaseSamples) MaxLockWaits() int {
+	max := 0
+	for _, s := range d {
+		if s.LockWaits > max {
+			max = s.LockWaits
+		}
+	}
+	return max
+}
+
+// MinCacheHitRatio returns the lowest cache hit ratio of the intervals.
+func (d DatabaseSamples) MinCacheHitRatio() float64 {
+	min := 100.0
+	for _, s := range d {
+		if s.CacheHitRatio < min {
+			min = s.CacheHitRatio
+		}
+	}
+	return min
+}
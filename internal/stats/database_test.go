@@ -0,0 +1,69 @@
+package stats
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDatabaseSample(t *testing.T) {
+	buffers := []uint64{40, 100}
+	before := DatabaseCounters{Commits: 100, BlocksRead: 10, BlocksHit: 90, CheckpointsTimed: 3, BuffersCheckpoint: 500,
+		BuffersBackend: &buffers[0]}
+	after := DatabaseCounters{
+		Commits:              300,
+		Rollbacks:            2,
+		BlocksRead:           30,
+		BlocksHit:            270,
+		CheckpointsTimed:     3,
+		CheckpointsRequested: 1,
+		BuffersCheckpoint:    800,
+		BuffersBackend:       &buffers[1],
+		WaitEvents:           map[string]int{"CPU": 3, "Lock:transactionid": 1},
+		LockWaits:            1,
+	}
+	s := NewDatabaseSample(2*time.Second, time.Second, before, after)
+	backend := uint64(60)
+	assert.Equal(t, &DatabaseSample{
+		Time:              2000,
+		Duration:          1000,
+		Commits:           200,
+		Rollbacks:         2,
+		BlocksRead:        20,
+		BlocksHit:         180,
+		CacheHitRatio:     90,
+		Checkpoints:       1,
+		BuffersCheckpoint: 300,
+		BuffersBackend:    &backend,
+		WaitEvents:        map[string]int{"CPU": 3, "Lock:transactionid": 1},
+		LockWaits:         1,
+	}, s)
+
+	// Idle intervals do not lower the cache hit ratio
+	idle := NewDatabaseSample(3*time.Second, time.Second, after, after)
+	assert.EqualValues(t, 100, idle.CacheHitRatio)
+
+	samples := DatabaseSamples{s, idle}
+	assert.EqualValues(t, 1, samples.Checkpoints())
+	assert.Equal(t, 1, samples.MaxLockWaits())
+	assert.EqualValues(t, 90, samples.MinCacheHitRatio())
+
+	report := &Report{DatabaseStats: samples}
+	buffer := strings.Builder{}
+	assert.NoError(t, report.Print(&buffer, false))
+	assert.Contains(t, buffer.String(), "\nDatabase activity:  2 samples, 1 checkpoints, up to 1 lock waits, cache hit ratio down to 90.0%\n")
+}
+
+func TestNewDatabaseSample_Unavailable(t *testing.T) {
+	// The backend buffers are not reported since PostgreSQL 17
+	s := NewDatabaseSample(time.Second, time.Second, DatabaseCounters{CheckpointsTimed: 1}, DatabaseCounters{CheckpointsTimed: 2})
+	assert.EqualValues(t, 1, s.Checkpoints)
+	assert.Nil(t, s.BuffersBackend)
+
+	content, err := json.Marshal(s)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `"buffers_backend":null`)
+}
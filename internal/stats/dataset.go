@@ -0,0 +1,36 @@
+package stats
+
+import "time"
+
+// Dataset is the fingerprint of the benchmarked hypertable, inspected before the run: its estimated row count,
+// its chunks and their longest time interval in milliseconds, and the time range of its data, nil if it is empty.
+// When the input could be checked, InputHosts and InputQueries count its distinct hosts and its queries, HostsFound
+// and QueriesInRange the ones found in the data. Warnings lists the mismatches between the input and the data.
+type Dataset struct {
+	Table              string     `json:"table"`
+	RowEstimate        int64      `json:"row_estimate"`
+	Chunks             int64      `json:"chunks"`
+	CompressedChunks   int64      `json:"compressed_chunks"`
+	CompressionEnabled bool       `json:"compression_enabled"`
+	ChunkInterval      float64    `json:"chunk_interval"`
+	MinTime            *time.Time `json:"min_ts,omitempty"`
+	MaxTime            *time.Time `json:"max_ts,omitempty"`
+	InputHosts         int        `json:"input_hosts,omitempty"`
+	HostsFound         int        `json:"hosts_found,omitempty"`
+	InputQueries       int        `json:"input_queries,omitempty"`
+	QueriesInRange     int        `json:"queries_in_range,omitempty"`
+	Warnings           []string   `json:"warnings,omitempty"`
+}
+
+// Interval returns the longest chunk interval.
+func (d *Dataset) Interval() time.Duration {
+	return time.Duration(d.ChunkInterval * float64(time.Millisecond))
+}
+
+// Overlaps returns whether the time range from start to end overlaps the data.
+func (d *Dataset) Overlaps(start, end time.Time) bool {
+	if d.MinTime == nil || d.MaxTime == nil {
+		return false
+	}
+	return !end.Before(*d.MinTime) && !start.After(*d.MaxTime)
+}
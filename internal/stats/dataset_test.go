@@ -0,0 +1,57 @@
+package stats
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDataset_Overlaps(t *testing.T) {
+	min := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	max := time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC)
+	d := &Dataset{MinTime: &min, MaxTime: &max}
+
+	assert.True(t, d.Overlaps(min.Add(time.Hour), min.Add(2*time.Hour)))
+	assert.True(t, d.Overlaps(min.Add(-time.Hour), min))
+	assert.True(t, d.Overlaps(max, max.Add(time.Hour)))
+	assert.False(t, d.Overlaps(max.Add(time.Second), max.Add(time.Hour)))
+	assert.False(t, d.Overlaps(min.Add(-time.Hour), min.Add(-time.Second)))
+
+	// An empty dataset overlaps nothing
+	assert.False(t, (&Dataset{}).Overlaps(min, max))
+}
+
+func TestReport_PrintDataset(t *testing.T) {
+	min := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	max := time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC)
+	report := &Report{Dataset: &Dataset{
+		Table:              "cpu_usage",
+		RowEstimate:        3456000,
+		Chunks:             2,
+		CompressedChunks:   1,
+		CompressionEnabled: true,
+		ChunkInterval:      float64(7 * 24 * time.Hour / time.Millisecond),
+		MinTime:            &min,
+		MaxTime:            &max,
+		InputHosts:         10,
+		HostsFound:         9,
+		InputQueries:       200,
+		QueriesInRange:     180,
+		Warnings:           []string{"1 of the 10 input hosts are not in cpu_usage"},
+	}}
+	buffer := strings.Builder{}
+	assert.NoError(t, report.Print(&buffer, false))
+	assert.True(t, strings.HasPrefix(buffer.String(), `
+Dataset:            cpu_usage, ~3456000 rows in 2 chunks of up to 168h0m0s, 1 compressed, 2017-01-01 00:00:00 to 2017-01-02 00:00:00 UTC
+Input coverage:     9 of 10 hosts found, 180 of 200 queries in the data's time range
+Warning: 1 of the 10 input hosts are not in cpu_usage
+
+Benchmark duration:`), buffer.String())
+
+	report.Dataset = &Dataset{Table: "cpu_usage"}
+	buffer.Reset()
+	assert.NoError(t, report.Print(&buffer, false))
+	assert.True(t, strings.HasPrefix(buffer.String(), "\nDataset:            cpu_usage, ~0 rows in 0 chunks of up to 0s, empty\n\nBenchmark duration:"), buffer.String())
+}
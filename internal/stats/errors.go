@@ -0,0 +1,196 @@
+package stats
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/jackc/pgconn"
+)
+
+// Error categories, server errors are further grouped by SQLSTATE code.
+const (
+	categoryServer     = "server"
+	categoryTimeout    = "timeout"
+	categoryConnection = "connection"
+	categoryInput      = "input"
+	categoryOther      = "other"
+)
+
+// InputError marks the errors caused by an invalid input row, detected before the query is sent to the server.
+type InputError struct {
+	Err error
+}
+
+func (e *InputError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *InputError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorGroup counts the errors of the same SQLSTATE code, or client-side category, with a sample message.
+type ErrorGroup struct {
+	Category string `json:"category"`
+	Code     string `json:"code,omitempty"`
+	Class    string `json:"class,omitempty"`
+	Name     string `json:"name"`
+	Count    uint64 `json:"count"`
+	Sample   string `json:"sample"`
+}
+
+// errorCounter groups errors by SQLSTATE code or category, keeping the first message of each group.
+type errorCounter struct {
+	groups map[string]*ErrorGroup
+}
+
+func newErrorCounter() *errorCounter {
+	return &errorCounter{groups: make(map[string]*ErrorGroup)}
+}
+
+func (e *errorCounter) add(err error) {
+	g := classifyError(err)
+	key := g.Category + g.Code
+	if existing, found := e.groups[key]; found {
+		existing.Count++
+		return
+	}
+	g.Count = 1
+	g.Sample = err.Error()
+	e.groups[key] = g
+}
+
+// list returns the error groups, most frequent first.
+func (e *errorCounter) list() []*ErrorGroup {
+	groups := make([]*ErrorGroup, 0, len(e.groups))
+	for _, g := range e.groups {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		return groups[i].Category+groups[i].Code < groups[j].Category+groups[j].Code
+	})
+	return groups
+}
+
+// classifyError returns the group of an error, unwrapping it to find a server error or a known client-side cause.
+func classifyError(err error) *ErrorGroup {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		g := &ErrorGroup{Category: categoryServer, Code: pgErr.Code, Name: sqlStateNames[pgErr.Code]}
+		if len(pgErr.Code) == 5 {
+			g.Class = pgErr.Code[:2]
+			if g.Name == "" {
+				g.Name = sqlStateClasses[g.Class]
+			}
+		}
+		if g.Name == "" {
+			g.Name = "unknown"
+		}
+		return g
+	}
+
+	var inputErr *InputError
+	var parseErr *csv.ParseError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &inputErr), errors.As(err, &parseErr):
+		return &ErrorGroup{Category: categoryInput, Name: "invalid input"}
+	case pgconn.Timeout(err), errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return &ErrorGroup{Category: categoryTimeout, Name: "query timeout"}
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.EPIPE), errors.As(err, &netErr),
+		// pgconn does not export the error returned when using a closed connection
+		strings.Contains(err.Error(), "conn closed"):
+		return &ErrorGroup{Category: categoryConnection, Name: "connection lost"}
+	default:
+		return &ErrorGroup{Category: categoryOther, Name: "other"}
+	}
+}
+
+// sqlStateNames lists the condition names of the SQLSTATE codes most likely to occur during a benchmark.
+var sqlStateNames = map[string]string{
+	"08000": "connection_exception",
+	"08003": "connection_does_not_exist",
+	"08006": "connection_failure",
+	"22007": "invalid_datetime_format",
+	"22008": "datetime_field_overflow",
+	"22012": "division_by_zero",
+	"22P02": "invalid_text_representation",
+	"23505": "unique_violation",
+	"25P02": "in_failed_sql_transaction",
+	"26000": "invalid_sql_statement_name",
+	"40001": "serialization_failure",
+	"40P01": "deadlock_detected",
+	"42501": "insufficient_privilege",
+	"42601": "syntax_error",
+	"42703": "undefined_column",
+	"42883": "undefined_function",
+	"42P01": "undefined_table",
+	"53100": "disk_full",
+	"53200": "out_of_memory",
+	"53300": "too_many_connections",
+	"54000": "program_limit_exceeded",
+	"55P03": "lock_not_available",
+	"57014": "query_canceled",
+	"57P01": "admin_shutdown",
+	"57P02": "crash_shutdown",
+	"57P03": "cannot_connect_now",
+	"58030": "io_error",
+	"XX000": "internal_error",
+}
+
+// sqlStateClasses lists the names of the SQLSTATE classes, used for codes missing from sqlStateNames.
+var sqlStateClasses = map[string]string{
+	"00": "successful_completion",
+	"01": "warning",
+	"02": "no_data",
+	"03": "sql_statement_not_yet_complete",
+	"08": "connection_exception",
+	"09": "triggered_action_exception",
+	"0A": "feature_not_supported",
+	"0B": "invalid_transaction_initiation",
+	"0F": "locator_exception",
+	"0L": "invalid_grantor",
+	"0P": "invalid_role_specification",
+	"0Z": "diagnostics_exception",
+	"20": "case_not_found",
+	"21": "cardinality_violation",
+	"22": "data_exception",
+	"23": "integrity_constraint_violation",
+	"24": "invalid_cursor_state",
+	"25": "invalid_transaction_state",
+	"26": "invalid_sql_statement_name",
+	"27": "triggered_data_change_violation",
+	"28": "invalid_authorization_specification",
+	"2B": "dependent_privilege_descriptors_still_exist",
+	"2D": "invalid_transaction_termination",
+	"2F": "sql_routine_exception",
+	"34": "invalid_cursor_name",
+	"38": "external_routine_exception",
+	"39": "external_routine_invocation_exception",
+	"3B": "savepoint_exception",
+	"3D": "invalid_catalog_name",
+	"3F": "invalid_schema_name",
+	"40": "transaction_rollback",
+	"42": "syntax_error_or_access_rule_violation",
+	"44": "with_check_option_violation",
+	"53": "insufficient_resources",
+	"54": "program_limit_exceeded",
+	"55": "object_not_in_prerequisite_state",
+	"57": "operator_intervention",
+	"58": "system_error",
+	"72": "snapshot_too_old",
+	"F0": "config_file_error",
+	"HV": "fdw_error",
+	"P0": "plpgsql_error",
+	"XX": "internal_error",
+}
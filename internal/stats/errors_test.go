@@ -0,0 +1,115 @@
+package stats
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassifyError(t *testing.T) {
+	cases := map[string]struct {
+		err      error
+		expected ErrorGroup
+	}{
+		"known SQLSTATE": {
+			err:      fmt.Errorf("wrapped: %w", &pgconn.PgError{Code: "57014", Message: "canceling statement due to statement timeout"}),
+			expected: ErrorGroup{Category: "server", Code: "57014", Class: "57", Name: "query_canceled"},
+		},
+		"SQLSTATE class": {
+			err:      &pgconn.PgError{Code: "53400", Message: "configuration limit exceeded"},
+			expected: ErrorGroup{Category: "server", Code: "53400", Class: "53", Name: "insufficient_resources"},
+		},
+		"unknown SQLSTATE": {
+			err:      &pgconn.PgError{Code: "ZZ"},
+			expected: ErrorGroup{Category: "server", Code: "ZZ", Name: "unknown"},
+		},
+		"deadline": {
+			err:      fmt.Errorf("wrapped: %w", context.DeadlineExceeded),
+			expected: ErrorGroup{Category: "timeout", Name: "query timeout"},
+		},
+		"network timeout": {
+			err:      &net.OpError{Op: "read", Err: timeoutError{}},
+			expected: ErrorGroup{Category: "timeout", Name: "query timeout"},
+		},
+		"unexpected EOF": {
+			err:      fmt.Errorf("wrapped: %w", io.ErrUnexpectedEOF),
+			expected: ErrorGroup{Category: "connection", Name: "connection lost"},
+		},
+		"network error": {
+			err:      &net.OpError{Op: "write", Err: fmt.Errorf("broken pipe")},
+			expected: ErrorGroup{Category: "connection", Name: "connection lost"},
+		},
+		"closed connection": {
+			err:      fmt.Errorf("conn closed"),
+			expected: ErrorGroup{Category: "connection", Name: "connection lost"},
+		},
+		"input error": {
+			err:      &InputError{Err: fmt.Errorf("statement expects 3 parameters, got 2")},
+			expected: ErrorGroup{Category: "input", Name: "invalid input"},
+		},
+		"parse error": {
+			err:      fmt.Errorf("cpu-buckets: %w", &csv.ParseError{Line: 3, Err: csv.ErrFieldCount}),
+			expected: ErrorGroup{Category: "input", Name: "invalid input"},
+		},
+		"other": {
+			err:      fmt.Errorf("something else"),
+			expected: ErrorGroup{Category: "other", Name: "other"},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, &c.expected, classifyError(c.err))
+		})
+	}
+}
+
+func TestErrorCounter(t *testing.T) {
+	e := newErrorCounter()
+	e.add(&pgconn.PgError{Severity: "ERROR", Code: "40001", Message: "could not serialize access"})
+	e.add(&pgconn.PgError{Severity: "ERROR", Code: "40001", Message: "another message"})
+	e.add(&pgconn.PgError{Severity: "FATAL", Code: "53300", Message: "too many connections"})
+	e.add(io.ErrUnexpectedEOF)
+	e.add(io.ErrUnexpectedEOF)
+
+	assert.Equal(t, []*ErrorGroup{
+		{Category: "connection", Name: "connection lost", Count: 2, Sample: "unexpected EOF"},
+		{Category: "server", Code: "40001", Class: "40", Name: "serialization_failure", Count: 2, Sample: "ERROR: could not serialize access (SQLSTATE 40001)"},
+		{Category: "server", Code: "53300", Class: "53", Name: "too_many_connections", Count: 1, Sample: "FATAL: too many connections (SQLSTATE 53300)"},
+	}, e.list())
+}
+
+func TestReport_PrintErrors(t *testing.T) {
+	report := &Report{
+		BenchConcurrency: 1,
+		QueriesPerWorker: []uint64{3},
+		QueriesOk:        1,
+		QueriesErr:       3,
+		Errors: []*ErrorGroup{
+			{Category: "server", Code: "57014", Class: "57", Name: "query_canceled", Count: 2, Sample: "ERROR: canceling statement due to statement timeout (SQLSTATE 57014)"},
+			{Category: "timeout", Name: "query timeout", Count: 1, Sample: "timeout: context deadline exceeded"},
+		},
+	}
+
+	buffer := strings.Builder{}
+	assert.NoError(t, report.Print(&buffer, false))
+	assert.Contains(t, buffer.String(), `
+Failed queries:     3 (75% error rate)
+  57014 query_canceled: 2 ("ERROR: canceling statement due to statement timeout (SQLSTATE 57014)")
+  query timeout: 1 ("timeout: context deadline exceeded")
+
+Measured query latency:
+`)
+}
@@ -0,0 +1,75 @@
+package stats
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// ExplainSample holds the server-side measures of a query sampled with EXPLAIN ANALYZE: its planning and execution
+// time, and the shared buffers hit in cache or read from disk.
+type ExplainSample struct {
+	Planning   time.Duration
+	Execution  time.Duration
+	SharedHit  uint64
+	SharedRead uint64
+}
+
+// Explain summarizes the queries sampled with EXPLAIN ANALYZE. Times are in milliseconds.
+// Overhead estimates the network and protocol overhead as the difference between the mean client-side latency
+// and the mean server-side execution time.
+type Explain struct {
+	Samples          uint64  `json:"samples"`
+	Failed           uint64  `json:"failed"`
+	Planning         Latency `json:"planning_time"`
+	Execution        Latency `json:"execution_time"`
+	SharedHitBlocks  uint64  `json:"shared_hit_blocks"`
+	SharedReadBlocks uint64  `json:"shared_read_blocks"`
+	Overhead         float64 `json:"estimated_overhead"`
+}
+
+// HitRatio returns the percentage of the shared buffers found in cache.
+func (e *Explain) HitRatio() float64 {
+	if e.SharedHitBlocks+e.SharedReadBlocks == 0 {
+		return 0
+	}
+	return 100 * float64(e.SharedHitBlocks) / float64(e.SharedHitBlocks+e.SharedReadBlocks)
+}
+
+// explainRecorder aggregates the sampled queries.
+type explainRecorder struct {
+	explain   Explain
+	planning  *latencyRecorder
+	execution *latencyRecorder
+}
+
+func newExplainRecorder(opts Options) *explainRecorder {
+	return &explainRecorder{
+		planning:  newLatencyRecorder(opts),
+		execution: newLatencyRecorder(opts),
+	}
+}
+
+func (e *explainRecorder) add(r Result) {
+	if r.Err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "explain error: %s\n", r.Err)
+		e.explain.Failed++
+		return
+	}
+	e.explain.Samples++
+	e.explain.SharedHitBlocks += r.Explain.SharedHit
+	e.explain.SharedReadBlocks += r.Explain.SharedRead
+	e.planning.insert(r.Explain.Planning)
+	e.execution.insert(r.Explain.Execution)
+}
+
+// summary returns the sampled measures, comparing them to the mean client-side latency.
+func (e *explainRecorder) summary(clientMean float64) *Explain {
+	s := e.explain
+	if s.Samples > 0 {
+		s.Planning = e.planning.summary()
+		s.Execution = e.execution.summary()
+		s.Overhead = clientMean - s.Execution.Mean
+	}
+	return &s
+}
@@ -0,0 +1,84 @@
+package stats
+
+import (
+	"math"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// maxTrackedRows caps the row counts recorded in the rows per query histogram.
+const maxTrackedRows = 1e9
+
+// Fetch holds the rows read by the successful queries in fetch mode. Bytes is the size of the row data.
+// FirstRow is the latency to the first row, the measured query latency being the one to the last row.
+type Fetch struct {
+	Rows         uint64       `json:"rows"`
+	Bytes        uint64       `json:"bytes"`
+	RowsPerQuery RowsPerQuery `json:"rows_per_query"`
+	FirstRow     Latency      `json:"first_row_latency"`
+}
+
+// RowsPerQuery holds the distribution of the number of rows returned by each query.
+type RowsPerQuery struct {
+	Min    uint64  `json:"min"`
+	Mean   float64 `json:"mean"`
+	Median uint64  `json:"median"`
+	P95    uint64  `json:"p95"`
+	P99    uint64  `json:"p99"`
+	Max    uint64  `json:"max"`
+}
+
+// fetchRecorder aggregates the row counts and time to first row of the queries.
+type fetchRecorder struct {
+	count    uint64
+	fetch    Fetch
+	perQuery *Histogram
+	firstRow *latencyRecorder
+}
+
+func newFetchRecorder(opts Options) *fetchRecorder {
+	precision := opts.Precision
+	if precision < 1 || precision > 5 {
+		precision = DefaultPrecision
+	}
+	return &fetchRecorder{
+		fetch: Fetch{
+			RowsPerQuery: RowsPerQuery{Min: math.MaxUint64},
+		},
+		perQuery: &Histogram{h: hdrhistogram.New(1, maxTrackedRows, precision)},
+		firstRow: newLatencyRecorder(opts),
+	}
+}
+
+func (f *fetchRecorder) add(r Result) {
+	f.count++
+	f.fetch.Rows += r.Rows
+	f.fetch.Bytes += r.Bytes
+	f.perQuery.recordValue(int64(r.Rows))
+	f.firstRow.insert(r.FirstRow)
+	if r.Rows < f.fetch.RowsPerQuery.Min {
+		f.fetch.RowsPerQuery.Min = r.Rows
+	}
+	if r.Rows > f.fetch.RowsPerQuery.Max {
+		f.fetch.RowsPerQuery.Max = r.Rows
+	}
+}
+
+func (f *fetchRecorder) summary() *Fetch {
+	s := f.fetch
+	s.RowsPerQuery.Mean = float64(s.Rows) / float64(f.count)
+	s.RowsPerQuery.Median = f.rowsAt(50)
+	s.RowsPerQuery.P95 = f.rowsAt(95)
+	s.RowsPerQuery.P99 = f.rowsAt(99)
+	s.FirstRow = f.firstRow.summary()
+	return &s
+}
+
+// rowsAt returns the row count at the given percentile, capped by the exact maximum.
+func (f *fetchRecorder) rowsAt(p float64) uint64 {
+	v := uint64(f.perQuery.valueAt(p))
+	if v > f.fetch.RowsPerQuery.Max {
+		return f.fetch.RowsPerQuery.Max
+	}
+	return v
+}
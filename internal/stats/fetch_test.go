@@ -0,0 +1,44 @@
+package stats
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadResults_Fetch(t *testing.T) {
+	resultChan := make(chan Result, 4)
+	resultChan <- Result{Latency: 10 * time.Millisecond, FirstRow: 2 * time.Millisecond, Rows: 10, Bytes: 100}
+	resultChan <- Result{Latency: 20 * time.Millisecond, FirstRow: 4 * time.Millisecond, Rows: 30, Bytes: 300}
+	resultChan <- Result{Latency: 3 * time.Millisecond, FirstRow: 3 * time.Millisecond}
+	close(resultChan)
+
+	report := ReadResults(1, resultChan, Options{})
+	require.NotNil(t, report.Fetch)
+	assert.EqualValues(t, 40, report.Fetch.Rows)
+	assert.EqualValues(t, 400, report.Fetch.Bytes)
+	assert.Equal(t, RowsPerQuery{Min: 0, Mean: 40. / 3, Median: 10, P95: 30, P99: 30, Max: 30}, report.Fetch.RowsPerQuery)
+	assert.EqualValues(t, 2, report.Fetch.FirstRow.Min)
+	assert.EqualValues(t, 4, report.Fetch.FirstRow.Max)
+	assert.EqualValues(t, 20, report.Max)
+
+	buffer := strings.Builder{}
+	assert.NoError(t, report.Print(&buffer, false))
+	assert.Contains(t, buffer.String(), `
+Fetched rows:       40 (400 bytes)
+Rows per query:     min 0, mean 13.3, median 10, p95 30, p99 30, max 30
+
+Time to first row:
+  Min:    2.000 ms
+`)
+}
+
+func TestReadResults_NoFetch(t *testing.T) {
+	resultChan := make(chan Result, 1)
+	resultChan <- Result{Latency: time.Millisecond}
+	close(resultChan)
+	assert.Nil(t, ReadResults(1, resultChan, Options{}).Fetch)
+}
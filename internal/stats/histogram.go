@@ -0,0 +1,111 @@
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+const (
+	// DefaultPrecision is the default number of significant digits of the latency histograms.
+	DefaultPrecision = 3
+	// histogramUnit is the resolution of the latency histograms.
+	histogramUnit = time.Microsecond
+	// maxTrackedLatency caps the recorded latencies, higher values are recorded as this one.
+	maxTrackedLatency = time.Hour
+)
+
+// Histogram records a latency distribution with a fixed relative precision, in microseconds.
+// It is serialized in the base64 compressed HdrHistogram format, and can be merged with the histograms
+// of other reports or analysed with HdrHistogram tools.
+type Histogram struct {
+	h *hdrhistogram.Histogram
+}
+
+// NewHistogram returns an empty histogram keeping the given number of significant digits, between 1 and 5.
+func NewHistogram(precision int) *Histogram {
+	if precision < 1 || precision > 5 {
+		precision = DefaultPrecision
+	}
+	return &Histogram{h: hdrhistogram.New(1, int64(maxTrackedLatency/histogramUnit), precision)}
+}
+
+// Record adds a latency to the histogram, clamped to the trackable range.
+func (h *Histogram) Record(d time.Duration) {
+	v := int64(d / histogramUnit)
+	if v < 1 {
+		v = 1
+	}
+	h.recordValue(v)
+}
+
+// recordValue adds a raw value to the histogram, capped to the highest trackable one.
+func (h *Histogram) recordValue(v int64) {
+	if v > h.h.HighestTrackableValue() {
+		v = h.h.HighestTrackableValue()
+	}
+	_ = h.h.RecordValue(v)
+}
+
+// Merge adds the values of another histogram. It returns the number of values dropped for being out of range.
+func (h *Histogram) Merge(other *Histogram) int64 {
+	return h.h.Merge(other.h)
+}
+
+// Count returns the number of recorded latencies.
+func (h *Histogram) Count() int64 {
+	return h.h.TotalCount()
+}
+
+// Percentile returns the latency at the given percentile (between 0 and 100), in milliseconds.
+// It uses the nearest-rank method: the lowest value such that p% of the recorded values are lower or equal.
+func (h *Histogram) Percentile(p float64) float64 {
+	return float64(h.valueAt(p)) * float64(histogramUnit) / float64(time.Millisecond)
+}
+
+// valueAt returns the raw value at the given percentile, using the nearest-rank method.
+func (h *Histogram) valueAt(p float64) int64 {
+	total := h.h.TotalCount()
+	// Avoid rounding up exact ranks because of floating point errors
+	rank := int64(math.Ceil(p*float64(total)/100 - 1e-9))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > total {
+		return h.h.Max()
+	}
+	// ValueAtPercentile rounds the count at the percentile to the nearest integer, convert the rank to a percentile
+	// it rounds back to
+	return h.h.ValueAtPercentile(100 * float64(rank) / float64(total))
+}
+
+// Reset removes all the recorded values, keeping the allocated buckets.
+func (h *Histogram) Reset() {
+	h.h.Reset()
+}
+
+// MarshalJSON encodes the histogram as a base64 string.
+func (h *Histogram) MarshalJSON() ([]byte, error) {
+	encoded, err := h.h.Encode(hdrhistogram.V2CompressedEncodingCookieBase)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode histogram: %w", err)
+	}
+	return json.Marshal(string(encoded))
+}
+
+// UnmarshalJSON decodes a histogram encoded by MarshalJSON.
+func (h *Histogram) UnmarshalJSON(data []byte) error {
+	var encoded string
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	decoded, err := hdrhistogram.Decode([]byte(encoded))
+	if err != nil {
+		return fmt.Errorf("cannot decode histogram: %w", err)
+	}
+	h.h = decoded
+	return nil
+}
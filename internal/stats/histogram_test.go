@@ -0,0 +1,91 @@
+package stats
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram(DefaultPrecision)
+	for i := 1; i <= 1000; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+	// Out of range values are clamped instead of dropped
+	h.Record(0)
+	h.Record(2 * maxTrackedLatency)
+
+	assert.EqualValues(t, 1002, h.Count())
+	assert.InEpsilon(t, 500, h.Percentile(50), 0.001)
+	assert.InEpsilon(t, 991, h.Percentile(99), 0.001)
+	assert.InEpsilon(t, 1000, h.Percentile(99.8), 0.001)
+	assert.InEpsilon(t, maxTrackedLatency.Seconds()*1000, h.Percentile(100), 0.001)
+}
+
+func TestHistogram_Precision(t *testing.T) {
+	for precision, epsilon := range map[int]float64{1: 0.1, 3: 0.001, 5: 0.00001} {
+		h := NewHistogram(precision)
+		h.Record(123456789 * time.Nanosecond)
+		assert.InEpsilon(t, 123.456, h.Percentile(50), epsilon, "precision %d", precision)
+	}
+}
+
+func TestHistogram_JSON(t *testing.T) {
+	first := NewHistogram(DefaultPrecision)
+	second := NewHistogram(DefaultPrecision)
+	for i := 1; i <= 100; i++ {
+		first.Record(time.Duration(i) * time.Millisecond)
+		second.Record(time.Duration(i+100) * time.Millisecond)
+	}
+
+	// Histograms of two reports can be decoded and merged
+	var decoded [2]*Histogram
+	for i, h := range []*Histogram{first, second} {
+		encoded, err := json.Marshal(h)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(encoded, &decoded[i]))
+		assert.EqualValues(t, 100, decoded[i].Count())
+	}
+	assert.Zero(t, decoded[0].Merge(decoded[1]))
+	assert.EqualValues(t, 200, decoded[0].Count())
+	assert.InEpsilon(t, 100, decoded[0].Percentile(50), 0.001)
+	assert.InEpsilon(t, 198, decoded[0].Percentile(99), 0.001)
+
+	assert.Error(t, json.Unmarshal([]byte(`"invalid"`), &decoded[0]))
+}
+
+func TestHistogram_NearestRank(t *testing.T) {
+	h := NewHistogram(DefaultPrecision)
+	assert.Zero(t, h.Percentile(50))
+	for i := 1; i <= 10; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+	for p, expected := range map[float64]float64{0: 1, 10: 1, 50: 5, 90: 9, 91: 10, 100: 10} {
+		assert.InEpsilon(t, expected, h.Percentile(p), 0.001, "p%g", p)
+	}
+}
+
+func TestLatencyRecorder_Reset(t *testing.T) {
+	l := newLatencyRecorder(Options{Precision: 5})
+	// The histogram is only allocated once a latency is recorded
+	assert.Nil(t, l.histogram)
+	assert.Equal(t, Latency{}, l.summary())
+
+	l.insert(10 * time.Millisecond)
+	l.insert(20 * time.Millisecond)
+	histogram := l.histogram
+	require.NotNil(t, histogram)
+	assert.EqualValues(t, 10, l.summary().Min)
+
+	// Resetting reuses the histogram
+	l.reset()
+	assert.Equal(t, Latency{}, l.summary())
+	l.insert(30 * time.Millisecond)
+	assert.Same(t, histogram, l.histogram)
+	assert.EqualValues(t, 1, histogram.Count())
+	assert.EqualValues(t, 30, l.summary().Min)
+	assert.InEpsilon(t, 30, l.summary().Median, 0.0001)
+}
@@ -0,0 +1,73 @@
+package stats
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// IntervalReport holds the results received during one reporting interval.
+// Time is the end of the interval since the start of the benchmark, Throughput is in queries per second.
+type IntervalReport struct {
+	Time       float64 `json:"time"`
+	Duration   float64 `json:"duration"`
+	Throughput float64 `json:"throughput"`
+	Summary
+}
+
+// intervalRecorder aggregates the results of the current interval, and writes a line for each one.
+type intervalRecorder struct {
+	opts    Options
+	start   time.Time
+	last    time.Time
+	output  io.Writer
+	current *Summary
+	latency *latencyRecorder
+	reports []*IntervalReport
+}
+
+func newIntervalRecorder(start time.Time, opts Options) *intervalRecorder {
+	return &intervalRecorder{
+		opts:    opts,
+		start:   start,
+		last:    start,
+		output:  opts.IntervalOutput,
+		current: &Summary{},
+		latency: newLatencyRecorder(opts),
+	}
+}
+
+func (i *intervalRecorder) add(r Result) {
+	if r.Reconnected || r.Explain != nil {
+		return
+	}
+	i.latency.add(i.current, r)
+}
+
+// pending returns whether results were received since the last interval was closed.
+func (i *intervalRecorder) pending() bool {
+	return i.current.QueriesOk+i.current.QueriesErr > 0
+}
+
+// flush closes the current interval.
+func (i *intervalRecorder) flush(now time.Time) {
+	elapsed := now.Sub(i.last)
+	i.current.Latency = i.latency.summary()
+	report := &IntervalReport{
+		Time:     durationToMs(now.Sub(i.start)),
+		Duration: durationToMs(elapsed),
+		Summary:  *i.current,
+	}
+	if elapsed > 0 {
+		report.Throughput = float64(report.QueriesOk+report.QueriesErr) / elapsed.Seconds()
+	}
+	i.reports = append(i.reports, report)
+	if i.output != nil {
+		_, _ = fmt.Fprintf(i.output, "[%7.1fs] %.1f queries/s, %d errors, latency min %.3f ms, p50 %.3f ms, p95 %.3f ms, p99 %.3f ms, max %.3f ms\n",
+			report.Time/1e3, report.Throughput, report.QueriesErr, report.Min, report.Median, report.P95, report.P99, report.Max)
+	}
+
+	i.last = now
+	i.current = &Summary{}
+	i.latency.reset()
+}
@@ -0,0 +1,80 @@
+package stats
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntervalRecorder(t *testing.T) {
+	output := &strings.Builder{}
+	start := time.Now()
+	i := newIntervalRecorder(start, Options{IntervalOutput: output})
+	assert.False(t, i.pending())
+
+	for l := 1; l <= 4; l++ {
+		i.add(Result{Latency: time.Duration(l) * time.Millisecond})
+	}
+	i.add(Result{Err: fmt.Errorf("one error")})
+	assert.True(t, i.pending())
+	i.flush(start.Add(time.Second))
+	assert.False(t, i.pending())
+
+	i.add(Result{Latency: 10 * time.Millisecond})
+	i.flush(start.Add(1500 * time.Millisecond))
+
+	require.Len(t, i.reports, 2)
+	assert.EqualValues(t, &IntervalReport{
+		Time:       1000,
+		Duration:   1000,
+		Throughput: 5,
+		Summary: Summary{
+			QueriesOk:  4,
+			QueriesErr: 1,
+			Latency:    Latency{Min: 1, Mean: 2.5, Median: 2, P90: 4, P95: 4, P99: 4, Max: 4, Sum: 10},
+		},
+	}, i.reports[0])
+	assert.EqualValues(t, &IntervalReport{
+		Time:       1500,
+		Duration:   500,
+		Throughput: 2,
+		Summary: Summary{
+			QueriesOk: 1,
+			Latency:   Latency{Min: 10, Mean: 10, Median: 10, P90: 10, P95: 10, P99: 10, Max: 10, Sum: 10},
+		},
+	}, i.reports[1])
+
+	assert.Equal(t, ""+
+		"[    1.0s] 5.0 queries/s, 1 errors, latency min 1.000 ms, p50 2.000 ms, p95 4.000 ms, p99 4.000 ms, max 4.000 ms\n"+
+		"[    1.5s] 2.0 queries/s, 0 errors, latency min 10.000 ms, p50 10.000 ms, p95 10.000 ms, p99 10.000 ms, max 10.000 ms\n",
+		output.String())
+}
+
+func TestReadResults_Intervals(t *testing.T) {
+	output := &strings.Builder{}
+	resultChan := make(chan Result)
+	go func() {
+		for i := 1; i <= 6; i++ {
+			resultChan <- Result{Latency: time.Duration(i) * time.Millisecond}
+			time.Sleep(10 * time.Millisecond)
+		}
+		close(resultChan)
+	}()
+
+	report := ReadResults(1, resultChan, Options{Interval: 20 * time.Millisecond, IntervalOutput: output})
+	require.NotEmpty(t, report.Intervals)
+	assert.Len(t, strings.Split(strings.TrimSpace(output.String()), "\n"), len(report.Intervals))
+
+	var total uint64
+	for _, i := range report.Intervals {
+		total += i.QueriesOk
+	}
+	assert.EqualValues(t, report.QueriesOk, total)
+	// The last interval ends at most one interval before the end of the benchmark
+	last := report.Intervals[len(report.Intervals)-1]
+	assert.InDelta(t, report.BenchDuration, last.Time, 20)
+}
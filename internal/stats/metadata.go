@@ -0,0 +1,35 @@
+package stats
+
+import "time"
+
+// Metadata ties a report to the build, configuration, input, database and client host of the run.
+// Flags holds the value of every command-line flag, defaults included, with the database passwords redacted.
+// InputSHA256 is the checksum of the input file, or of the workload file, empty for stdin. WorkloadFiles holds the
+// checksums of the query and input files referenced by the workload, by path, stdin excluded.
+type Metadata struct {
+	Version       string            `json:"version"`
+	Commit        string            `json:"commit,omitempty"`
+	Start         time.Time         `json:"start"`
+	End           time.Time         `json:"end"`
+	Flags         map[string]string `json:"flags,omitempty"`
+	Input         string            `json:"input"`
+	InputSHA256   string            `json:"input_sha256,omitempty"`
+	WorkloadFiles map[string]string `json:"workload_files,omitempty"`
+	Server        *ServerInfo       `json:"server,omitempty"`
+	Client        ClientInfo        `json:"client"`
+}
+
+// ServerInfo holds the versions of the first benchmarked database, and the settings impacting query performance.
+// TimescaleVersion is empty if the extension is not installed.
+type ServerInfo struct {
+	Version          string            `json:"server_version"`
+	TimescaleVersion string            `json:"timescaledb_version,omitempty"`
+	Settings         map[string]string `json:"settings"`
+}
+
+// ClientInfo describes the host running the benchmark.
+type ClientInfo struct {
+	Hostname   string `json:"hostname"`
+	CPUs       int    `json:"cpus"`
+	GOMAXPROCS int    `json:"gomaxprocs"`
+}
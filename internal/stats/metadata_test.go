@@ -0,0 +1,75 @@
+package stats
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReport_PrintMetadata(t *testing.T) {
+	start := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	report := &Report{
+		Metadata: &Metadata{
+			Version:     "v1.2.0",
+			Commit:      "983b398",
+			Start:       start,
+			End:         start.Add(time.Minute),
+			Flags:       map[string]string{"concurrency": "4"},
+			Input:       "data/query_params.csv",
+			InputSHA256: "5d41402abc4b2a76b9719d911017c592",
+			Server: &ServerInfo{
+				Version:          "14.2",
+				TimescaleVersion: "2.6.0",
+				Settings:         map[string]string{"work_mem": "4MB", "jit": "off"},
+			},
+			Client: ClientInfo{Hostname: "bench-1", CPUs: 8, GOMAXPROCS: 8},
+		},
+		Dataset: &Dataset{Table: "cpu_usage"},
+	}
+	buffer := strings.Builder{}
+	require.NoError(t, report.Print(&buffer, false))
+	assert.True(t, strings.HasPrefix(buffer.String(), `
+Run:                2022-03-01 10:00:00 to 2022-03-01 10:01:00 UTC, pgbench v1.2.0 (983b398)
+Input:              data/query_params.csv (sha256 5d41402abc4b2a76b9719d911017c592)
+Server:             PostgreSQL 14.2, TimescaleDB 2.6.0, jit=off, work_mem=4MB
+Client:             bench-1, 8 CPUs, GOMAXPROCS 8
+
+Dataset:            cpu_usage, ~0 rows in 0 chunks of up to 0s, empty
+
+Benchmark duration:`), buffer.String())
+
+	// The server is omitted if it could not be read
+	report.Metadata.Server = nil
+	report.Metadata.Commit = ""
+	report.Dataset = nil
+	buffer.Reset()
+	require.NoError(t, report.Print(&buffer, false))
+	assert.True(t, strings.HasPrefix(buffer.String(), `
+Run:                2022-03-01 10:00:00 to 2022-03-01 10:01:00 UTC, pgbench v1.2.0
+Input:              data/query_params.csv (sha256 5d41402abc4b2a76b9719d911017c592)
+Client:             bench-1, 8 CPUs, GOMAXPROCS 8
+
+Benchmark duration:`), buffer.String())
+
+	// The files referenced by a workload are listed under its workload file
+	report.Metadata.Input = "workload.yaml"
+	report.Metadata.WorkloadFiles = map[string]string{"hostnames.csv": "8f14e45f", "query_params.csv": "c9f0f895"}
+	buffer.Reset()
+	require.NoError(t, report.Print(&buffer, false))
+	assert.True(t, strings.HasPrefix(buffer.String(), `
+Run:                2022-03-01 10:00:00 to 2022-03-01 10:01:00 UTC, pgbench v1.2.0
+Input:              workload.yaml (sha256 5d41402abc4b2a76b9719d911017c592)
+  hostnames.csv (sha256 8f14e45f)
+  query_params.csv (sha256 c9f0f895)
+Client:`), buffer.String())
+
+	buffer.Reset()
+	require.NoError(t, report.Print(&buffer, true))
+	var decoded Report
+	require.NoError(t, json.Unmarshal([]byte(buffer.String()), &decoded))
+	assert.Equal(t, report.Metadata, decoded.Metadata)
+}
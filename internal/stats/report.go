@@ -6,101 +6,644 @@ import (
 	"io"
 	"math"
 	"os"
+	"sort"
 	"text/template"
 	"time"
-
-	"github.com/beorn7/perks/quantile"
 )
 
-const outputTemplateText = `
-Benchmark duration: {{ formatMs .BenchDuration }}
-Concurrency Level:  {{ .BenchConcurrency }} workers
-Queries per worker: {{ printf "%v" .QueriesPerWorker }}
-
-Completed queries:  {{ .QueriesOk }}
-Failed queries:     {{ .QueriesErr }} ({{ errorRate . }}% error rate)
+const (
+	// DefaultTopKeys is the default number of slowest routing keys listed in the text report.
+	DefaultTopKeys = 10
+	// keyPrecision is the highest number of significant digits of the per-key latency histograms.
+	keyPrecision = 2
+)
 
-Measured query latency:
+const latencyTemplateText = `{{ define "latency" }}
   Min:    {{ formatMs .Min }}
   Mean:   {{ formatMs .Mean }}
+{{- if .Percentiles }}
+{{- range .Percentiles }}
+  {{ printf "%-8s" (printf "p%g:" .Percentile) }}{{ formatMs .Latency }}
+{{- end }}
+{{- else }}
   Median: {{ formatMs .Median }}
   p90:    {{ formatMs .P90 }}
   p95:    {{ formatMs .P95 }}
   p99:    {{ formatMs .P99 }}
+{{- end }}
   Max:    {{ formatMs .Max }}
   Sum:    {{ formatMs .Sum }}
+{{- end }}`
+
+const outputTemplateText = `
+{{- if .Aborted }}
+Benchmark aborted: {{ .Aborted }}, partial results:
+{{ else if .Interrupted }}
+Benchmark interrupted, partial results:
+{{ end }}
+{{- with .Metadata }}
+Run:                {{ .Start.UTC.Format "2006-01-02 15:04:05" }} to {{ .End.UTC.Format "2006-01-02 15:04:05" }} UTC, pgbench {{ .Version }}{{ with .Commit }} ({{ . }}){{ end }}
+Input:              {{ .Input }}{{ with .InputSHA256 }} (sha256 {{ . }}){{ end }}
+{{- range $path, $sum := .WorkloadFiles }}
+  {{ $path }} (sha256 {{ $sum }})
+{{- end }}
+{{- with .Server }}
+Server:             PostgreSQL {{ .Version }}{{ with .TimescaleVersion }}, TimescaleDB {{ . }}{{ end }}
+{{- range $name, $value := .Settings }}, {{ $name }}={{ $value }}{{ end }}
+{{- end }}
+Client:             {{ .Client.Hostname }}, {{ .Client.CPUs }} CPUs, GOMAXPROCS {{ .Client.GOMAXPROCS }}
+{{ end }}
+{{- with .Dataset }}
+Dataset:            {{ .Table }}, ~{{ .RowEstimate }} rows in {{ .Chunks }} chunks of up to {{ .Interval }}{{ if .CompressionEnabled }}, {{ .CompressedChunks }} compressed{{ end }}
+{{- if .MinTime }}, {{ .MinTime.UTC.Format "2006-01-02 15:04:05" }} to {{ .MaxTime.UTC.Format "2006-01-02 15:04:05" }} UTC{{ else }}, empty{{ end }}
+{{- if .InputQueries }}
+Input coverage:     {{ .HostsFound }} of {{ .InputHosts }} hosts found, {{ .QueriesInRange }} of {{ .InputQueries }} queries in the data's time range
+{{- end }}
+{{- range .Warnings }}
+Warning: {{ . }}
+{{- end }}
+{{ end }}
+Benchmark duration: {{ formatMs .BenchDuration }}
+Input passes:       {{ .BenchPasses }}
+{{- with .Warmup }}
+Warmup:             {{ formatMs $.WarmupDuration }}, {{ .QueriesOk }} completed, {{ .QueriesErr }} failed, mean latency {{ formatMs .Mean }}, p99 {{ formatMs .P99 }}
+{{- end }}
+Concurrency Level:  {{ .BenchConcurrency }} workers
+{{- if .PoolSize }}
+Connection pool:    {{ .PoolSize }} connections
+{{- end }}
+Queries per worker: {{ printf "%v" .QueriesPerWorker }}
+{{- with .ReconnectsPerWorker }}
+Reconnects:         {{ printf "%v" . }}
+Disconnected (ms):  {{ printf "%.1f" $.DisconnectedPerWorker }}
+{{- end }}
+
+Completed queries:  {{ .QueriesOk }}
+Failed queries:     {{ .QueriesErr }} ({{ errorRate .QueriesOk .QueriesErr }}% error rate){{ if .QueriesTimeout }}, {{ .QueriesTimeout }} timed out{{ end }}
+{{- range .Errors }}
+  {{ if .Code }}{{ .Code }} {{ end }}{{ .Name }}: {{ .Count }} ({{ printf "%q" .Sample }})
+{{- end }}
+
+Measured query latency:
+{{- template "latency" .Latency }}
+{{- with .AcquireWait }}
+
+Pool acquire wait:
+{{- template "latency" . }}
+{{- end }}
+{{- with .QueueWait }}
+
+Client queue wait:
+{{- template "latency" . }}
+{{- end }}
+{{- if .QueueBound }}
+Warning: queries waited longer in the client-side queues than they ran, the workers or the routing are the bottleneck
+{{- end }}
+{{- with .Fetch }}
+
+Fetched rows:       {{ .Rows }} ({{ .Bytes }} bytes)
+Rows per query:     min {{ .RowsPerQuery.Min }}, mean {{ printf "%.1f" .RowsPerQuery.Mean }}, median {{ .RowsPerQuery.Median }}, p95 {{ .RowsPerQuery.P95 }}, p99 {{ .RowsPerQuery.P99 }}, max {{ .RowsPerQuery.Max }}
+
+Time to first row:
+{{- template "latency" .FirstRow }}
+{{- end }}
+{{- with .Explain }}
+
+Sampled server-side execution (EXPLAIN ANALYZE): {{ .Samples }} queries{{ if .Failed }}, {{ .Failed }} failed{{ end }}
+{{- if .Samples }}
+  Planning:   Mean: {{ formatMs .Planning.Mean }}, Median: {{ formatMs .Planning.Median }}, p99: {{ formatMs .Planning.P99 }}, Max: {{ formatMs .Planning.Max }}
+  Execution:  Mean: {{ formatMs .Execution.Mean }}, Median: {{ formatMs .Execution.Median }}, p99: {{ formatMs .Execution.P99 }}, Max: {{ formatMs .Execution.Max }}
+  Buffers:    {{ .SharedHitBlocks }} hit, {{ .SharedReadBlocks }} read ({{ printf "%.1f" .HitRatio }}% hit ratio)
+  Estimated network and protocol overhead: {{ formatMs .Overhead }} (mean client latency minus mean execution time)
+{{- end }}
+{{- end }}
+{{- with .ServerStatements }}
+
+Server-side statement statistics (pg_stat_statements):
+{{- range $name, $s := . }}
+  {{ $name }}: {{ $s.Calls }} calls, mean execution {{ formatMs $s.MeanExecTime }}, total {{ formatMs $s.TotalExecTime }}
+    Shared blocks: {{ $s.SharedBlocksHit }} hit, {{ $s.SharedBlocksRead }} read, temp blocks: {{ $s.TempBlocks }}, WAL: {{ $s.WalBytes }} bytes
+{{- end }}
+{{- end }}
+{{- with .DatabaseStats }}
+
+Database activity:  {{ len . }} samples, {{ .Checkpoints }} checkpoints, up to {{ .MaxLockWaits }} lock waits, cache hit ratio down to {{ printf "%.1f" .MinCacheHitRatio }}%
+{{- end }}
+{{- with .Schedule }}
+
+Target rate:        {{ printf "%.1f" .Rate }} queries/s ({{ if .Poisson }}poisson{{ else }}fixed{{ end }} arrivals)
+Dispatcher lag:     mean {{ formatMs .MeanLag }}, max {{ formatMs .MaxLag }}
+{{- end }}
+{{- with .Corrected }}
+
+Corrected query latency (from intended start time):
+{{- template "latency" . }}
+{{- end }}
+{{- with .Stages }}
+
+Load stages:
+{{- range $i, $s := . }}
+  Stage {{ inc $i }}: {{ $s.Concurrency }} workers for {{ formatMs $s.Duration }}, {{ printf "%.1f" $s.Throughput }} queries/s, {{ $s.QueriesErr }} failed ({{ errorRate $s.QueriesOk $s.QueriesErr }}% error rate)
+    Mean: {{ formatMs $s.Mean }}, Median: {{ formatMs $s.Median }}, p95: {{ formatMs $s.P95 }}, p99: {{ formatMs $s.P99 }}, Max: {{ formatMs $s.Max }}
+{{- end }}
+{{- end }}
+{{- with .Targets }}
+
+Per-target breakdown:
+{{- range . }}
+  {{ .Name }}: {{ printf "%.1f" .Throughput }} queries/s, {{ .QueriesOk }} completed, {{ .QueriesErr }} failed ({{ errorRate .QueriesOk .QueriesErr }}% error rate)
+    Mean: {{ formatMs .Mean }}, Median: {{ formatMs .Median }}, p95: {{ formatMs .P95 }}, p99: {{ formatMs .P99 }}, Max: {{ formatMs .Max }}
+{{- end }}
+{{- end }}
+{{- with .Workers }}
+
+Per-worker breakdown:
+{{- range $i, $s := . }}
+  Worker {{ $i }}: {{ $s.QueriesOk }} completed, {{ $s.QueriesErr }} failed ({{ errorRate $s.QueriesOk $s.QueriesErr }}% error rate)
+    Mean: {{ formatMs $s.Mean }}, Median: {{ formatMs $s.Median }}, p95: {{ formatMs $s.P95 }}, p99: {{ formatMs $s.P99 }}, Max: {{ formatMs $s.Max }}
+{{- end }}
+{{- end }}
+{{- with .SlowestKeys }}
+
+Slowest routing keys (by p99 latency, {{ len . }} of {{ len $.Keys }}):
+{{- range . }}
+  {{ .Key }}: {{ .QueriesOk }} completed, {{ .QueriesErr }} failed ({{ errorRate .QueriesOk .QueriesErr }}% error rate)
+    Min: {{ formatMs .Min }}, Mean: {{ formatMs .Mean }}, Median: {{ formatMs .Median }}, p99: {{ formatMs .P99 }}, Max: {{ formatMs .Max }}
+{{- end }}
+{{- end }}
+{{- if .Statements }}
+
+Per-statement breakdown:
+{{- range $name, $s := .Statements }}
+  {{ $name }}: {{ $s.QueriesOk }} completed, {{ $s.QueriesErr }} failed ({{ errorRate $s.QueriesOk $s.QueriesErr }}% error rate)
+    Mean: {{ formatMs $s.Mean }}, Median: {{ formatMs $s.Median }}, p95: {{ formatMs $s.P95 }}, p99: {{ formatMs $s.P99 }}, Max: {{ formatMs $s.Max }}
+{{- end }}
+{{- end }}
 `
 
 // Result holds the execution result for one query, to be aggregated into a Report.
+// Results with Reconnected or Explain set are not queries, and are only aggregated in their own report section.
 type Result struct {
-	Worker  int
-	Latency time.Duration
-	Err     error
+	Worker    int
+	Target    int    // Index of the database the query ran on, in Options.Targets
+	Key       string // Routing key of the query
+	Statement string
+	Warmup    bool // Warmup results are summarized separately
+	Stage     int  // 1-based index of the load stage, if set
+	Latency   time.Duration
+	// Latency from the intended start time of the query in open-loop mode, to correct the coordinated omission
+	CorrectedLatency time.Duration
+	Timeout          bool // Timed out queries are counted as failed
+	Err              error
+	// Set instead of a query result to record the time a worker spent disconnected after a connection loss
+	Reconnected  bool
+	Disconnected time.Duration
+	// In fetch mode, number and size of the rows read, and latency to the first row, or to the end of the query
+	// if it returned no rows
+	Rows     uint64
+	Bytes    uint64
+	FirstRow time.Duration
+	// Time spent waiting for a connection in pool mode, and in the client-side queues before a worker picked up
+	// the query, both excluded from Latency
+	AcquireWait time.Duration
+	QueueWait   time.Duration
+	// Set instead of a query result to hold the server-side measures of a sampled query, or its EXPLAIN error in Err
+	Explain *ExplainSample
+}
+
+// Latency holds the latency summary for a set of successful queries, in milliseconds.
+type Latency struct {
+	Min    float64 `json:"min_latency"`
+	Mean   float64 `json:"mean_latency"`
+	Median float64 `json:"median_latency"`
+	P90    float64 `json:"p90_latency"`
+	P95    float64 `json:"p95_latency"`
+	P99    float64 `json:"p99_latency"`
+	Max    float64 `json:"max_latency"`
+	Sum    float64 `json:"latency_sum"`
+	// Percentiles requested with Options.Percentiles, if any
+	Percentiles []Percentile `json:"percentiles,omitempty"`
+}
+
+// Percentile holds the latency at a given percentile, in milliseconds.
+type Percentile struct {
+	Percentile float64 `json:"percentile"`
+	Latency    float64 `json:"latency"`
 }
 
 // Report holds raw data for the benchmark report. Durations are in milliseconds.
 type Report struct {
+	// Build, configuration, input, database and client host of the run
+	Metadata *Metadata `json:"metadata,omitempty"`
+
 	BenchConcurrency uint32   `json:"bench_concurrency"`
 	BenchDuration    float64  `json:"bench_duration"`
+	BenchPasses      uint64   `json:"bench_passes"`
+	PoolSize         uint32   `json:"pool_size,omitempty"`
 	QueriesPerWorker []uint64 `json:"queries_per_worker"`
-	QueriesErr       uint64   `json:"queries_error"`
-	QueriesOk        uint64   `json:"queries_ok"`
-	Min              float64  `json:"min_latency"`
-	Mean             float64  `json:"mean_latency"`
-	Median           float64  `json:"median_latency"`
-	P90              float64  `json:"p90_latency"`
-	P95              float64  `json:"p95_latency"`
-	P99              float64  `json:"p99_latency"`
-	Max              float64  `json:"max_latency"`
-	Sum              float64  `json:"latency_sum"`
+	// Reconnections after a connection loss, and time spent disconnected in milliseconds, if any
+	ReconnectsPerWorker   []uint64      `json:"reconnects_per_worker,omitempty"`
+	DisconnectedPerWorker []float64     `json:"disconnected_per_worker,omitempty"`
+	QueriesErr            uint64        `json:"queries_error"`
+	QueriesOk             uint64        `json:"queries_ok"`
+	QueriesTimeout        uint64        `json:"queries_timeout,omitempty"`
+	Errors                []*ErrorGroup `json:"errors,omitempty"`
+	Latency
+	Statements     map[string]*Summary `json:"statements,omitempty"`
+	Warmup         *Summary            `json:"warmup,omitempty"`
+	WarmupDuration float64             `json:"warmup_duration,omitempty"`
+	Corrected      *Latency            `json:"corrected_latency,omitempty"`
+	Fetch          *Fetch              `json:"fetch,omitempty"`
+	AcquireWait    *Latency            `json:"acquire_wait,omitempty"`
+	QueueWait      *Latency            `json:"queue_wait,omitempty"`
+	Explain        *Explain            `json:"explain,omitempty"`
+	Schedule       *Schedule           `json:"schedule,omitempty"`
+	Stages         []*StageReport      `json:"stages,omitempty"`
+	Targets        []*TargetReport     `json:"targets,omitempty"`
+	Intervals      []*IntervalReport   `json:"intervals,omitempty"`
+	Interrupted    bool                `json:"interrupted,omitempty"`
+	Aborted        string              `json:"aborted,omitempty"`
+	// Increase of the pg_stat_statements counters of the benchmarked statements during the run, by name
+	ServerStatements map[string]*StatementStats `json:"pg_stat_statements,omitempty"`
+	// Activity of the database polled during the run, if enabled
+	DatabaseStats DatabaseSamples `json:"database_stats,omitempty"`
+	// Fingerprint of the benchmarked hypertable, inspected before the run unless --preflight=off
+	Dataset *Dataset `json:"dataset,omitempty"`
+	// QueueBound is set if open-loop queries waited longer in the client-side queues than they ran on average,
+	// a sign that the workers or the routing are the bottleneck rather than the database
+	QueueBound bool `json:"queue_bound,omitempty"`
+	// Per-worker and per-routing key breakdowns if enabled, keys sorted from the slowest p99 latency
+	Workers     []*Summary   `json:"workers,omitempty"`
+	Keys        []*KeyReport `json:"keys,omitempty"`
+	SlowestKeys []*KeyReport `json:"-"`
+	// Latency distributions of the measured queries, to merge or re-analyse reports
+	Histogram          *Histogram `json:"histogram,omitempty"`
+	CorrectedHistogram *Histogram `json:"corrected_histogram,omitempty"`
+}
+
+// StageReport holds the results of one load stage. Throughput is in queries per second.
+type StageReport struct {
+	Concurrency uint32  `json:"concurrency"`
+	Duration    float64 `json:"duration"`
+	Throughput  float64 `json:"throughput"`
+	Summary
+}
+
+// TargetReport holds the results of the queries run on one of the benchmarked databases.
+// Throughput is in queries per second over the benchmark duration.
+type TargetReport struct {
+	Name       string  `json:"name"`
+	Throughput float64 `json:"throughput"`
+	Summary
+}
+
+// KeyReport holds the results of the queries with the same routing key.
+type KeyReport struct {
+	Key string `json:"key"`
+	Summary
+}
+
+// Schedule holds the open-loop mode parameters, and how far behind schedule the queries were dispatched.
+type Schedule struct {
+	Rate    float64 `json:"target_rate"`
+	Poisson bool    `json:"poisson_arrivals"`
+	MeanLag float64 `json:"mean_dispatch_lag"`
+	MaxLag  float64 `json:"max_dispatch_lag"`
+}
+
+// Summary holds the query counts and latency for a subset of the results.
+type Summary struct {
+	QueriesErr uint64 `json:"queries_error"`
+	QueriesOk  uint64 `json:"queries_ok"`
+	Latency
+}
+
+// Options configures the aggregation of results.
+// If Interval is set, a summary of each interval is written to IntervalOutput and kept in the report.
+// Precision is the number of significant digits of the latency histograms. If set, Percentiles are added to the
+// JSON report next to the default ones, and replace them in the text report.
+// If more than MaxErrors queries fail, or the error rate over the last ErrorWindow queries exceeds MaxErrorRate
+// percent, the reason is recorded in the report and Abort is called once, for the caller to stop the run.
+// When benchmarking several databases, Targets holds their names, and the report breaks the results down per target.
+// WorkerBreakdown and KeyBreakdown add the latency of each worker and routing key, the text report listing the TopKeys
+// slowest keys.
+type Options struct {
+	Interval        time.Duration
+	IntervalOutput  io.Writer
+	Precision       int
+	Percentiles     []float64
+	MaxErrors       uint64
+	MaxErrorRate    float64
+	ErrorWindow     int
+	Abort           func()
+	Targets         []string
+	WorkerBreakdown bool
+	KeyBreakdown    bool
+	TopKeys         int
 }
 
 // ReadResults consumes a channel of Result and returns the aggregated benchmark Report.
-func ReadResults(concurrency uint32, c <-chan Result) *Report {
+// The per-statement breakdown is only kept if results for several statements are received.
+// The benchmark duration starts when receiving the first result not part of the warmup.
+func ReadResults(concurrency uint32, c <-chan Result, opts Options) *Report {
+	col := newCollector(concurrency, opts)
+
+	var tick <-chan time.Time
+	var intervals *intervalRecorder
+	if opts.Interval > 0 {
+		ticker := time.NewTicker(opts.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+		intervals = newIntervalRecorder(col.start, opts)
+	}
+
+	for {
+		select {
+		case r, ok := <-c:
+			if !ok {
+				if intervals != nil {
+					if intervals.pending() {
+						intervals.flush(time.Now())
+					}
+					col.stats.Intervals = intervals.reports
+				}
+				return col.report()
+			}
+			if intervals != nil {
+				intervals.add(r)
+			}
+			col.add(r)
+		case now := <-tick:
+			intervals.flush(now)
+		}
+	}
+}
+
+// collector aggregates the results into a Report.
+type collector struct {
+	opts             Options
+	start            time.Time
+	measureStart     time.Time
+	stats            Report
+	latency          *latencyRecorder
+	correctedLatency *latencyRecorder
+	acquireWait      *latencyRecorder
+	queueWait        *latencyRecorder
+	scheduled        bool // Whether the queries ran in open-loop mode
+	statementLatency map[string]*latencyRecorder
+	warmup           *Summary
+	warmupLatency    *latencyRecorder
+	stageLatency     []*latencyRecorder
+	targetLatency    []*latencyRecorder
+	workerLatency    []*latencyRecorder
+	keys             map[string]*KeyReport
+	keyLatency       map[string]*latencyRecorder
+	errors           *errorCounter
+	abort            *abortChecker    // Abort thresholds, if set
+	fetch            *fetchRecorder   // Rows read in fetch mode, if any
+	explain          *explainRecorder // Queries sampled with EXPLAIN ANALYZE, if any
+}
+
+func newCollector(concurrency uint32, opts Options) *collector {
 	start := time.Now()
-	stats := Report{
-		BenchConcurrency: concurrency,
-		QueriesPerWorker: make([]uint64, concurrency),
-		Min:              math.MaxFloat64,
-		// Keep other fields at zero
-	}
-	quantiles := quantile.NewTargeted(map[float64]float64{
-		0.50: 0.005,
-		0.90: 0.001,
-		0.95: 0.0005,
-		0.99: 0.0001,
-	})
+	col := &collector{
+		opts:         opts,
+		start:        start,
+		measureStart: start,
+		stats: Report{
+			BenchConcurrency: concurrency,
+			QueriesPerWorker: make([]uint64, concurrency),
+			Statements:       make(map[string]*Summary),
+		},
+		latency:          newLatencyRecorder(opts),
+		correctedLatency: newLatencyRecorder(opts),
+		acquireWait:      newLatencyRecorder(opts),
+		queueWait:        newLatencyRecorder(opts),
+		statementLatency: make(map[string]*latencyRecorder),
+		warmup:           &Summary{},
+		warmupLatency:    newLatencyRecorder(opts),
+		errors:           newErrorCounter(),
+		abort:            newAbortChecker(opts),
+	}
+	if opts.WorkerBreakdown {
+		for i := uint32(0); i < concurrency; i++ {
+			col.stats.Workers = append(col.stats.Workers, &Summary{})
+			col.workerLatency = append(col.workerLatency, newLatencyRecorder(opts))
+		}
+	}
+	if opts.KeyBreakdown {
+		col.keys = make(map[string]*KeyReport)
+		col.keyLatency = make(map[string]*latencyRecorder)
+	}
+	if len(opts.Targets) > 1 {
+		for _, name := range opts.Targets {
+			col.stats.Targets = append(col.stats.Targets, &TargetReport{Name: name})
+			col.targetLatency = append(col.targetLatency, newLatencyRecorder(opts))
+		}
+	}
+	return col
+}
 
-	for r := range c {
-		if r.Worker >= 0 && r.Worker < len(stats.QueriesPerWorker) {
-			stats.QueriesPerWorker[r.Worker]++
+func (c *collector) add(r Result) {
+	stats := &c.stats
+	if r.Reconnected {
+		c.addReconnect(r)
+		return
+	}
+	if r.Explain != nil {
+		if c.explain == nil {
+			c.explain = newExplainRecorder(c.opts)
 		}
-		if r.Err != nil {
-			_, _ = fmt.Fprintf(os.Stderr, "execution error: %s\n", r.Err)
-			stats.QueriesErr++
-			continue
+		c.explain.add(r)
+		return
+	}
+	if r.Err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "execution error: %s\n", r.Err)
+	}
+	c.checkAbort(r)
+	if r.Warmup {
+		c.warmupLatency.add(c.warmup, r)
+		return
+	}
+	if stats.QueriesOk+stats.QueriesErr == 0 && c.warmup.QueriesOk+c.warmup.QueriesErr > 0 {
+		c.measureStart = time.Now()
+		stats.WarmupDuration = durationToMs(c.measureStart.Sub(c.start))
+	}
+
+	if r.Worker >= 0 && r.Worker < len(stats.QueriesPerWorker) {
+		stats.QueriesPerWorker[r.Worker]++
+	}
+	if r.AcquireWait > 0 {
+		c.acquireWait.insert(r.AcquireWait)
+	}
+	if r.QueueWait > 0 {
+		c.queueWait.insert(r.QueueWait)
+	}
+	if r.Err != nil {
+		stats.QueriesErr++
+		c.errors.add(r.Err)
+		if r.Timeout {
+			stats.QueriesTimeout++
 		}
+	} else {
 		stats.QueriesOk++
-
-		latencyMs := durationToMs(r.Latency)
-		quantiles.Insert(latencyMs)
-		stats.Sum += latencyMs
-		if latencyMs > stats.Max {
-			stats.Max = latencyMs
+		c.latency.insert(r.Latency)
+		if r.CorrectedLatency > 0 {
+			c.scheduled = true
+			c.correctedLatency.insert(r.CorrectedLatency)
+		}
+		if r.FirstRow > 0 {
+			if c.fetch == nil {
+				c.fetch = newFetchRecorder(c.opts)
+			}
+			c.fetch.add(r)
+		}
+	}
+	if r.Statement != "" {
+		statement := stats.Statements[r.Statement]
+		if statement == nil {
+			statement = &Summary{}
+			stats.Statements[r.Statement] = statement
+			c.statementLatency[r.Statement] = newLatencyRecorder(c.opts)
+		}
+		c.statementLatency[r.Statement].add(statement, r)
+	}
+	if r.Stage > 0 {
+		for len(stats.Stages) < r.Stage {
+			stats.Stages = append(stats.Stages, &StageReport{})
+			c.stageLatency = append(c.stageLatency, newLatencyRecorder(c.opts))
+		}
+		c.stageLatency[r.Stage-1].add(&stats.Stages[r.Stage-1].Summary, r)
+	}
+	if r.Target >= 0 && r.Target < len(stats.Targets) {
+		c.targetLatency[r.Target].add(&stats.Targets[r.Target].Summary, r)
+	}
+	if r.Worker >= 0 && r.Worker < len(stats.Workers) {
+		c.workerLatency[r.Worker].add(stats.Workers[r.Worker], r)
+	}
+	if c.keys != nil {
+		key := c.keys[r.Key]
+		if key == nil {
+			key = &KeyReport{Key: r.Key}
+			c.keys[r.Key] = key
+			c.keyLatency[r.Key] = newKeyLatencyRecorder(c.opts)
 		}
-		if latencyMs < stats.Min {
-			stats.Min = latencyMs
+		c.keyLatency[r.Key].add(&key.Summary, r)
+	}
+}
+
+// checkAbort aborts the run the first time a threshold is crossed. Results received afterwards,
+// until the workers stop, are still counted.
+func (c *collector) checkAbort(r Result) {
+	if c.abort == nil || c.stats.Aborted != "" {
+		return
+	}
+	if reason := c.abort.add(r.Err != nil); reason != "" {
+		c.stats.Aborted = reason
+		_, _ = fmt.Fprintf(os.Stderr, "Aborting the benchmark: %s\n", reason)
+		if c.opts.Abort != nil {
+			c.opts.Abort()
 		}
 	}
+}
 
-	stats.BenchDuration = durationToMs(time.Since(start))
-	stats.Mean = stats.Sum / float64(stats.QueriesOk)
-	stats.Median = quantiles.Query(0.50)
-	stats.P90 = quantiles.Query(0.90)
-	stats.P95 = quantiles.Query(0.95)
-	stats.P99 = quantiles.Query(0.99)
+// addReconnect records the reconnection of a worker after a connection loss.
+func (c *collector) addReconnect(r Result) {
+	stats := &c.stats
+	if r.Worker < 0 || r.Worker >= len(stats.QueriesPerWorker) {
+		return
+	}
+	if stats.ReconnectsPerWorker == nil {
+		stats.ReconnectsPerWorker = make([]uint64, len(stats.QueriesPerWorker))
+		stats.DisconnectedPerWorker = make([]float64, len(stats.QueriesPerWorker))
+	}
+	stats.ReconnectsPerWorker[r.Worker]++
+	stats.DisconnectedPerWorker[r.Worker] += durationToMs(r.Disconnected)
+}
 
-	return &stats
+func (c *collector) report() *Report {
+	stats := &c.stats
+	stats.BenchDuration = durationToMs(time.Since(c.measureStart))
+	stats.Latency = c.latency.summary()
+	stats.Errors = c.errors.list()
+	if c.latency.count > 0 {
+		stats.Histogram = c.latency.histogram
+	}
+	if c.correctedLatency.count > 0 {
+		corrected := c.correctedLatency.summary()
+		stats.Corrected = &corrected
+		stats.CorrectedHistogram = c.correctedLatency.histogram
+	}
+	if c.acquireWait.count > 0 {
+		wait := c.acquireWait.summary()
+		stats.AcquireWait = &wait
+	}
+	if c.queueWait.count > 0 {
+		wait := c.queueWait.summary()
+		stats.QueueWait = &wait
+		stats.QueueBound = c.scheduled && c.latency.count > 0 && wait.Mean > stats.Latency.Mean
+	}
+	if c.fetch != nil {
+		stats.Fetch = c.fetch.summary()
+	}
+	if c.explain != nil {
+		stats.Explain = c.explain.summary(stats.Latency.Mean)
+	}
+	if len(stats.Statements) < 2 {
+		stats.Statements = nil
+	}
+	for name, s := range stats.Statements {
+		s.Latency = c.statementLatency[name].summary()
+	}
+	for i, s := range stats.Stages {
+		s.Latency = c.stageLatency[i].summary()
+	}
+	for i, s := range stats.Workers {
+		s.Latency = c.workerLatency[i].summary()
+	}
+	if c.keys != nil {
+		c.sortKeys()
+	}
+	for i, t := range stats.Targets {
+		t.Latency = c.targetLatency[i].summary()
+		if stats.BenchDuration > 0 {
+			t.Throughput = float64(t.QueriesOk+t.QueriesErr) / (stats.BenchDuration / 1000)
+		}
+	}
+	if c.warmup.QueriesOk+c.warmup.QueriesErr > 0 {
+		c.warmup.Latency = c.warmupLatency.summary()
+		stats.Warmup = c.warmup
+	}
+	return stats
+}
+
+// sortKeys lists the routing keys from the slowest to the fastest p99 latency, and keeps the slowest ones
+// for the text report.
+func (c *collector) sortKeys() {
+	stats := &c.stats
+	stats.Keys = make([]*KeyReport, 0, len(c.keys))
+	for name, k := range c.keys {
+		k.Latency = c.keyLatency[name].summary()
+		stats.Keys = append(stats.Keys, k)
+	}
+	sort.Slice(stats.Keys, func(i, j int) bool {
+		a, b := stats.Keys[i], stats.Keys[j]
+		if a.P99 != b.P99 {
+			return a.P99 > b.P99
+		}
+		if a.Max != b.Max {
+			return a.Max > b.Max
+		}
+		return a.Key < b.Key
+	})
+	top := c.opts.TopKeys
+	if top <= 0 {
+		top = DefaultTopKeys
+	}
+	if top > len(stats.Keys) {
+		top = len(stats.Keys)
+	}
+	stats.SlowestKeys = stats.Keys[:top]
 }
 
 // Print can be used to output the report, either in text or json format.
@@ -114,11 +657,17 @@ func (s *Report) Print(w io.Writer, toJson bool) error {
 		"formatMs": func(v float64) string {
 			return fmt.Sprintf("%.3f ms", v)
 		},
-		"errorRate": func(s *Report) int {
+		"inc": func(i int) int {
+			return i + 1
+		},
+		"errorRate": func(ok, failed uint64) int {
+			if ok+failed == 0 {
+				return 0
+			}
 			// Return error rate rounded up to percent
-			return int(math.Ceil(float64(s.QueriesErr) / float64(s.QueriesOk+s.QueriesErr)))
+			return int(math.Ceil(100 * float64(failed) / float64(ok+failed)))
 		},
-	}).Parse(outputTemplateText)
+	}).Parse(latencyTemplateText + outputTemplateText)
 	if err != nil {
 		return err
 	}
@@ -126,6 +675,95 @@ func (s *Report) Print(w io.Writer, toJson bool) error {
 	return tpl.Execute(w, s)
 }
 
+// newKeyLatencyRecorder returns a recorder for a routing key. With thousands of keys, their histograms
+// keep a lower precision to bound the memory usage.
+func newKeyLatencyRecorder(opts Options) *latencyRecorder {
+	if opts.Precision < 1 || opts.Precision > keyPrecision {
+		opts.Precision = keyPrecision
+	}
+	return newLatencyRecorder(opts)
+}
+
+// latencyRecorder aggregates query latencies into a Latency summary.
+// Min, max and sum are exact, percentiles are computed from a histogram. The histogram is allocated on the first
+// latency, as a high precision histogram takes megabytes and many recorders are never used.
+type latencyRecorder struct {
+	count       uint64
+	latency     Latency
+	histogram   *Histogram
+	precision   int
+	percentiles []float64
+}
+
+func newLatencyRecorder(opts Options) *latencyRecorder {
+	return &latencyRecorder{
+		latency: Latency{
+			Min: math.MaxFloat64,
+			// Keep other fields at zero
+		},
+		precision:   opts.Precision,
+		percentiles: opts.Percentiles,
+	}
+}
+
+// reset clears the recorded latencies, reusing the histogram.
+func (l *latencyRecorder) reset() {
+	l.count = 0
+	l.latency = Latency{Min: math.MaxFloat64}
+	if l.histogram != nil {
+		l.histogram.Reset()
+	}
+}
+
+// add counts a result into the given summary, recording its latency if successful.
+func (l *latencyRecorder) add(s *Summary, r Result) {
+	if r.Err != nil {
+		s.QueriesErr++
+		return
+	}
+	s.QueriesOk++
+	l.insert(r.Latency)
+}
+
+func (l *latencyRecorder) insert(d time.Duration) {
+	latencyMs := durationToMs(d)
+	l.count++
+	if l.histogram == nil {
+		l.histogram = NewHistogram(l.precision)
+	}
+	l.histogram.Record(d)
+	l.latency.Sum += latencyMs
+	if latencyMs > l.latency.Max {
+		l.latency.Max = latencyMs
+	}
+	if latencyMs < l.latency.Min {
+		l.latency.Min = latencyMs
+	}
+}
+
+// summary returns the latency summary, zeroed if no query succeeded.
+func (l *latencyRecorder) summary() Latency {
+	if l.count == 0 {
+		return Latency{}
+	}
+	s := l.latency
+	s.Mean = s.Sum / float64(l.count)
+	s.Median = l.percentile(50)
+	s.P90 = l.percentile(90)
+	s.P95 = l.percentile(95)
+	s.P99 = l.percentile(99)
+	for _, p := range l.percentiles {
+		s.Percentiles = append(s.Percentiles, Percentile{Percentile: p, Latency: l.percentile(p)})
+	}
+	return s
+}
+
+// percentile returns the latency at the given percentile. Histogram values are rounded up to the
+// highest value of their bucket, they are capped by the exact maximum.
+func (l *latencyRecorder) percentile(p float64) float64 {
+	return math.Min(l.histogram.Percentile(p), l.latency.Max)
+}
+
 func durationToMs(d time.Duration) float64 {
 	return float64(d) / 1e6
 }
@@ -1,12 +1,14 @@
 package stats
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestReadResults(t *testing.T) {
@@ -23,52 +25,196 @@ func TestReadResults(t *testing.T) {
 		close(resultChan)
 	}()
 
-	report := ReadResults(4, resultChan)
+	report := ReadResults(4, resultChan, Options{})
 	assert.Greater(t, report.BenchDuration, 0.)
 	report.BenchDuration = 0
+	require.NotNil(t, report.Histogram)
+	assert.EqualValues(t, 12, report.Histogram.Count())
+	report.Histogram = nil
 
 	assert.EqualValues(t, &Report{
 		BenchConcurrency: 4,
 		QueriesPerWorker: []uint64{5, 3, 3, 3},
 		QueriesErr:       2,
 		QueriesOk:        12,
-		Min:              1,
-		Mean:             6.5,
-		Median:           6,
-		P90:              11,
-		P95:              12,
-		P99:              12,
-		Max:              12,
-		Sum:              78,
+		Errors: []*ErrorGroup{
+			{Category: "other", Name: "other", Count: 2, Sample: "one error"},
+		},
+		Latency: Latency{
+			Min:    1,
+			Mean:   6.5,
+			Median: 6.003, // Rounded up to the histogram precision
+			P90:    11.007,
+			P95:    12,
+			P99:    12,
+			Max:    12,
+			Sum:    78,
+		},
 	}, report)
 }
 
+func TestReadResults_Statements(t *testing.T) {
+	resultChan := make(chan Result)
+	go func() {
+		for i := 1; i < 5; i++ {
+			resultChan <- Result{
+				Statement: "buckets",
+				Latency:   time.Duration(i) * time.Millisecond,
+			}
+		}
+		resultChan <- Result{Statement: "last-point", Latency: 10 * time.Millisecond}
+		resultChan <- Result{Statement: "last-point", Err: fmt.Errorf("one error")}
+		resultChan <- Result{Statement: "range-scan", Err: fmt.Errorf("another error")}
+		close(resultChan)
+	}()
+
+	report := ReadResults(1, resultChan, Options{})
+	assert.EqualValues(t, 5, report.QueriesOk)
+	assert.EqualValues(t, 2, report.QueriesErr)
+	assert.Equal(t, map[string]*Summary{
+		"buckets": {
+			QueriesOk: 4,
+			Latency: Latency{
+				Min:    1,
+				Mean:   2.5,
+				Median: 2,
+				P90:    4,
+				P95:    4,
+				P99:    4,
+				Max:    4,
+				Sum:    10,
+			},
+		},
+		"last-point": {
+			QueriesOk:  1,
+			QueriesErr: 1,
+			Latency: Latency{
+				Min:    10,
+				Mean:   10,
+				Median: 10,
+				P90:    10,
+				P95:    10,
+				P99:    10,
+				Max:    10,
+				Sum:    10,
+			},
+		},
+		"range-scan": {
+			QueriesErr: 1,
+		},
+	}, report.Statements)
+}
+
+func TestReadResults_SingleStatement(t *testing.T) {
+	resultChan := make(chan Result, 2)
+	resultChan <- Result{Statement: "buckets", Latency: time.Millisecond}
+	resultChan <- Result{Statement: "buckets", Err: fmt.Errorf("one error")}
+	close(resultChan)
+
+	report := ReadResults(1, resultChan, Options{})
+	assert.EqualValues(t, 1, report.QueriesOk)
+	assert.Nil(t, report.Statements)
+}
+
+func TestReadResults_Warmup(t *testing.T) {
+	resultChan := make(chan Result)
+	go func() {
+		resultChan <- Result{Warmup: true, Err: fmt.Errorf("cold error")}
+		for i := 1; i < 5; i++ {
+			resultChan <- Result{Warmup: true, Latency: 100 * time.Millisecond}
+		}
+		for i := 1; i < 5; i++ {
+			resultChan <- Result{Worker: 1, Latency: time.Duration(i) * time.Millisecond}
+		}
+		close(resultChan)
+	}()
+
+	report := ReadResults(2, resultChan, Options{})
+	assert.Equal(t, []uint64{0, 4}, report.QueriesPerWorker)
+	assert.EqualValues(t, 4, report.QueriesOk)
+	assert.EqualValues(t, 0, report.QueriesErr)
+	assert.EqualValues(t, 4, report.Max)
+	assert.EqualValues(t, 10, report.Sum)
+	assert.Greater(t, report.WarmupDuration, 0.)
+	assert.Equal(t, &Summary{
+		QueriesErr: 1,
+		QueriesOk:  4,
+		Latency: Latency{
+			Min:    100,
+			Mean:   100,
+			Median: 100,
+			P90:    100,
+			P95:    100,
+			P99:    100,
+			Max:    100,
+			Sum:    400,
+		},
+	}, report.Warmup)
+}
+
+func TestReadResults_Corrected(t *testing.T) {
+	resultChan := make(chan Result, 3)
+	resultChan <- Result{Latency: time.Millisecond, CorrectedLatency: 3 * time.Millisecond}
+	resultChan <- Result{Latency: time.Millisecond, CorrectedLatency: 5 * time.Millisecond}
+	resultChan <- Result{Err: fmt.Errorf("one error")}
+	close(resultChan)
+
+	report := ReadResults(1, resultChan, Options{})
+	assert.EqualValues(t, 1, report.Max)
+	require.NotNil(t, report.Corrected)
+	assert.EqualValues(t, 3, report.Corrected.Min)
+	assert.EqualValues(t, 4, report.Corrected.Mean)
+	assert.EqualValues(t, 5, report.Corrected.Max)
+}
+
+func TestReadResults_Stages(t *testing.T) {
+	resultChan := make(chan Result, 5)
+	resultChan <- Result{Stage: 1, Latency: time.Millisecond}
+	resultChan <- Result{Stage: 1, Latency: 3 * time.Millisecond}
+	resultChan <- Result{Stage: 2, Err: fmt.Errorf("one error")}
+	resultChan <- Result{Stage: 2, Latency: 10 * time.Millisecond}
+	resultChan <- Result{Stage: 2, Warmup: true, Latency: 100 * time.Millisecond}
+	close(resultChan)
+
+	report := ReadResults(1, resultChan, Options{})
+	require.Len(t, report.Stages, 2)
+	assert.EqualValues(t, 2, report.Stages[0].QueriesOk)
+	assert.EqualValues(t, 2, report.Stages[0].Mean)
+	assert.EqualValues(t, 1, report.Stages[1].QueriesOk)
+	assert.EqualValues(t, 1, report.Stages[1].QueriesErr)
+	assert.EqualValues(t, 10, report.Stages[1].Max)
+}
+
 func TestReport_Print(t *testing.T) {
 	report := &Report{
 		BenchConcurrency: 4,
 		BenchDuration:    12.34567890,
+		BenchPasses:      1,
 		QueriesPerWorker: []uint64{5, 3, 3, 3},
 		QueriesErr:       2,
 		QueriesOk:        12,
-		Min:              1.12345678,
-		Mean:             6.5,
-		Median:           6,
-		P90:              11,
-		P95:              12,
-		P99:              12,
-		Max:              12,
-		Sum:              78,
+		Latency: Latency{
+			Min:    1.12345678,
+			Mean:   6.5,
+			Median: 6,
+			P90:    11,
+			P95:    12,
+			P99:    12,
+			Max:    12,
+			Sum:    78,
+		},
 	}
 
 	buffer := strings.Builder{}
 	assert.NoError(t, report.Print(&buffer, false))
 	assert.Equal(t, `
 Benchmark duration: 12.346 ms
+Input passes:       1
 Concurrency Level:  4 workers
 Queries per worker: [5 3 3 3]
 
 Completed queries:  12
-Failed queries:     2 (1% error rate)
+Failed queries:     2 (15% error rate)
 
 Measured query latency:
   Min:    1.123 ms
@@ -86,6 +232,7 @@ Measured query latency:
 	assert.Equal(t, `{
   "bench_concurrency": 4,
   "bench_duration": 12.3456789,
+  "bench_passes": 1,
   "queries_per_worker": [
     5,
     3,
@@ -105,3 +252,375 @@ Measured query latency:
 }
 `, buffer.String())
 }
+
+func TestReport_PrintStatements(t *testing.T) {
+	report := &Report{
+		BenchConcurrency: 1,
+		BenchDuration:    10,
+		QueriesPerWorker: []uint64{3},
+		QueriesOk:        3,
+		Latency:          Latency{Min: 1, Mean: 2, Median: 2, P90: 3, P95: 3, P99: 3, Max: 3, Sum: 6},
+		Statements: map[string]*Summary{
+			"last-point": {QueriesOk: 1, QueriesErr: 2, Latency: Latency{Min: 3, Mean: 3, Median: 3, P90: 3, P95: 3, P99: 3, Max: 3, Sum: 3}},
+			"buckets":    {QueriesOk: 2, Latency: Latency{Min: 1, Mean: 1.5, Median: 1, P90: 2, P95: 2, P99: 2, Max: 2, Sum: 3}},
+		},
+	}
+
+	buffer := strings.Builder{}
+	assert.NoError(t, report.Print(&buffer, false))
+	assert.Contains(t, buffer.String(), `
+  Sum:    6.000 ms
+
+Per-statement breakdown:
+  buckets: 2 completed, 0 failed (0% error rate)
+    Mean: 1.500 ms, Median: 1.000 ms, p95: 2.000 ms, p99: 2.000 ms, Max: 2.000 ms
+  last-point: 1 completed, 2 failed (67% error rate)
+    Mean: 3.000 ms, Median: 3.000 ms, p95: 3.000 ms, p99: 3.000 ms, Max: 3.000 ms
+`)
+}
+
+func TestReport_PrintWarmup(t *testing.T) {
+	report := &Report{
+		BenchConcurrency: 1,
+		BenchPasses:      1,
+		QueriesPerWorker: []uint64{3},
+		WarmupDuration:   1234.5,
+		Warmup: &Summary{
+			QueriesOk:  10,
+			QueriesErr: 1,
+			Latency:    Latency{Mean: 12.5, P99: 40},
+		},
+	}
+
+	buffer := strings.Builder{}
+	assert.NoError(t, report.Print(&buffer, false))
+	assert.Contains(t, buffer.String(), `
+Input passes:       1
+Warmup:             1234.500 ms, 10 completed, 1 failed, mean latency 12.500 ms, p99 40.000 ms
+Concurrency Level:  1 workers
+`)
+}
+
+func TestReport_PrintCorrected(t *testing.T) {
+	report := &Report{
+		BenchConcurrency: 1,
+		QueriesPerWorker: []uint64{3},
+		Latency:          Latency{Min: 1, Mean: 2, Median: 2, P90: 3, P95: 3, P99: 3, Max: 3, Sum: 6},
+		Corrected:        &Latency{Min: 1, Mean: 4, Median: 3, P90: 8, P95: 8, P99: 8, Max: 8, Sum: 12},
+		Schedule:         &Schedule{Rate: 500, Poisson: true, MeanLag: 0.25, MaxLag: 2},
+	}
+
+	buffer := strings.Builder{}
+	assert.NoError(t, report.Print(&buffer, false))
+	assert.Contains(t, buffer.String(), `
+  Sum:    6.000 ms
+
+Target rate:        500.0 queries/s (poisson arrivals)
+Dispatcher lag:     mean 0.250 ms, max 2.000 ms
+
+Corrected query latency (from intended start time):
+  Min:    1.000 ms
+  Mean:   4.000 ms
+  Median: 3.000 ms
+  p90:    8.000 ms
+  p95:    8.000 ms
+  p99:    8.000 ms
+  Max:    8.000 ms
+  Sum:    12.000 ms
+`)
+}
+
+func TestReport_PrintStages(t *testing.T) {
+	report := &Report{
+		BenchConcurrency: 8,
+		QueriesPerWorker: []uint64{3},
+		Stages: []*StageReport{{
+			Concurrency: 4,
+			Duration:    60000,
+			Throughput:  1234.56,
+			Summary:     Summary{QueriesOk: 10, Latency: Latency{Mean: 1, Median: 1, P95: 2, P99: 3, Max: 4}},
+		}, {
+			Concurrency: 8,
+			Duration:    60000,
+			Throughput:  2000,
+			Summary:     Summary{QueriesOk: 10, Latency: Latency{Mean: 2, Median: 2, P95: 4, P99: 6, Max: 8}},
+		}},
+	}
+
+	buffer := strings.Builder{}
+	assert.NoError(t, report.Print(&buffer, false))
+	assert.Contains(t, buffer.String(), `
+Load stages:
+  Stage 1: 4 workers for 60000.000 ms, 1234.6 queries/s, 0 failed (0% error rate)
+    Mean: 1.000 ms, Median: 1.000 ms, p95: 2.000 ms, p99: 3.000 ms, Max: 4.000 ms
+  Stage 2: 8 workers for 60000.000 ms, 2000.0 queries/s, 0 failed (0% error rate)
+    Mean: 2.000 ms, Median: 2.000 ms, p95: 4.000 ms, p99: 6.000 ms, Max: 8.000 ms
+`)
+}
+
+func TestReport_PrintInterrupted(t *testing.T) {
+	report := &Report{
+		BenchConcurrency: 1,
+		BenchDuration:    1234.5,
+		QueriesPerWorker: []uint64{3},
+		Interrupted:      true,
+	}
+
+	buffer := strings.Builder{}
+	assert.NoError(t, report.Print(&buffer, false))
+	assert.True(t, strings.HasPrefix(buffer.String(), `
+Benchmark interrupted, partial results:
+
+Benchmark duration: 1234.500 ms
+`), buffer.String())
+
+	buffer.Reset()
+	assert.NoError(t, report.Print(&buffer, true))
+	assert.Contains(t, buffer.String(), `"interrupted": true`)
+}
+
+func TestReadResults_Percentiles(t *testing.T) {
+	resultChan := make(chan Result)
+	go func() {
+		for i := 1; i <= 1000; i++ {
+			resultChan <- Result{Latency: time.Duration(i) * time.Millisecond}
+		}
+		close(resultChan)
+	}()
+
+	report := ReadResults(1, resultChan, Options{Percentiles: []float64{50, 99.9, 99.99}})
+	require.Len(t, report.Percentiles, 3)
+	for i, expected := range []Percentile{{50, 500}, {99.9, 999}, {99.99, 1000}} {
+		assert.Equal(t, expected.Percentile, report.Percentiles[i].Percentile)
+		assert.InEpsilon(t, expected.Latency, report.Percentiles[i].Latency, 0.001)
+	}
+	// Percentiles are capped by the exact maximum
+	assert.EqualValues(t, 1000, report.Percentiles[2].Latency)
+}
+
+func TestReport_PrintPercentiles(t *testing.T) {
+	report := &Report{
+		BenchConcurrency: 1,
+		QueriesPerWorker: []uint64{3},
+		Latency: Latency{
+			Min: 1, Mean: 2, Max: 3, Sum: 6,
+			Percentiles: []Percentile{{50, 2}, {99.9, 3}, {99.99, 3}},
+		},
+	}
+
+	buffer := strings.Builder{}
+	assert.NoError(t, report.Print(&buffer, false))
+	assert.Contains(t, buffer.String(), `
+Measured query latency:
+  Min:    1.000 ms
+  Mean:   2.000 ms
+  p50:    2.000 ms
+  p99.9:  3.000 ms
+  p99.99: 3.000 ms
+  Max:    3.000 ms
+  Sum:    6.000 ms
+`)
+}
+
+func TestReadResults_Timeout(t *testing.T) {
+	resultChan := make(chan Result, 3)
+	resultChan <- Result{Latency: time.Millisecond}
+	resultChan <- Result{Err: fmt.Errorf("timeout: %w", context.DeadlineExceeded), Timeout: true}
+	resultChan <- Result{Err: fmt.Errorf("another error")}
+	close(resultChan)
+
+	report := ReadResults(1, resultChan, Options{})
+	assert.EqualValues(t, 1, report.QueriesOk)
+	assert.EqualValues(t, 2, report.QueriesErr)
+	assert.EqualValues(t, 1, report.QueriesTimeout)
+
+	buffer := strings.Builder{}
+	assert.NoError(t, report.Print(&buffer, false))
+	assert.Contains(t, buffer.String(), "Failed queries:     2 (67% error rate), 1 timed out\n")
+}
+
+func TestReadResults_Reconnects(t *testing.T) {
+	resultChan := make(chan Result, 4)
+	resultChan <- Result{Worker: 1, Err: fmt.Errorf("conn closed")}
+	resultChan <- Result{Worker: 1, Reconnected: true, Disconnected: 1500 * time.Millisecond}
+	resultChan <- Result{Worker: 1, Reconnected: true, Disconnected: 500 * time.Millisecond}
+	resultChan <- Result{Worker: 0, Latency: time.Millisecond}
+	close(resultChan)
+
+	report := ReadResults(2, resultChan, Options{})
+	assert.EqualValues(t, 1, report.QueriesOk)
+	assert.EqualValues(t, 1, report.QueriesErr)
+	assert.Equal(t, []uint64{1, 1}, report.QueriesPerWorker)
+	assert.Equal(t, []uint64{0, 2}, report.ReconnectsPerWorker)
+	assert.Equal(t, []float64{0, 2000}, report.DisconnectedPerWorker)
+
+	buffer := strings.Builder{}
+	assert.NoError(t, report.Print(&buffer, false))
+	assert.Contains(t, buffer.String(), `
+Queries per worker: [1 1]
+Reconnects:         [0 2]
+Disconnected (ms):  [0.0 2000.0]
+`)
+}
+
+func TestReadResults_AcquireWait(t *testing.T) {
+	resultChan := make(chan Result, 3)
+	resultChan <- Result{Latency: time.Millisecond, AcquireWait: 2 * time.Millisecond}
+	resultChan <- Result{Latency: time.Millisecond, AcquireWait: 4 * time.Millisecond}
+	resultChan <- Result{Err: fmt.Errorf("cannot acquire connection"), AcquireWait: 6 * time.Millisecond}
+	close(resultChan)
+
+	report := ReadResults(8, resultChan, Options{})
+	report.PoolSize = 2
+	require.NotNil(t, report.AcquireWait)
+	assert.InDelta(t, 12.0, report.AcquireWait.Sum, 0.01)
+	assert.InDelta(t, 6.0, report.AcquireWait.Max, 0.01)
+	assert.InDelta(t, 1.0, report.Latency.Max, 0.01)
+
+	buffer := strings.Builder{}
+	assert.NoError(t, report.Print(&buffer, false))
+	assert.Contains(t, buffer.String(), "Connection pool:    2 connections\n")
+	assert.Contains(t, buffer.String(), "Pool acquire wait:\n")
+}
+
+func TestReadResults_Targets(t *testing.T) {
+	resultChan := make(chan Result, 4)
+	resultChan <- Result{Target: 0, Latency: time.Millisecond}
+	resultChan <- Result{Target: 0, Latency: 3 * time.Millisecond}
+	resultChan <- Result{Target: 1, Latency: 10 * time.Millisecond}
+	resultChan <- Result{Target: 1, Err: fmt.Errorf("read only")}
+	close(resultChan)
+
+	report := ReadResults(2, resultChan, Options{Targets: []string{"primary:5432/tsdb", "replica:5432/tsdb"}})
+	require.Len(t, report.Targets, 2)
+	assert.Equal(t, "primary:5432/tsdb", report.Targets[0].Name)
+	assert.EqualValues(t, 2, report.Targets[0].QueriesOk)
+	assert.InDelta(t, 3.0, report.Targets[0].Max, 0.01)
+	assert.EqualValues(t, 1, report.Targets[1].QueriesOk)
+	assert.EqualValues(t, 1, report.Targets[1].QueriesErr)
+	assert.InDelta(t, 10.0, report.Targets[1].Max, 0.01)
+	assert.Greater(t, report.Targets[1].Throughput, 0.0)
+
+	buffer := strings.Builder{}
+	assert.NoError(t, report.Print(&buffer, false))
+	assert.Contains(t, buffer.String(), "\nPer-target breakdown:\n  primary:5432/tsdb: ")
+	assert.Contains(t, buffer.String(), "queries/s, 1 completed, 1 failed (50% error rate)\n")
+
+	// A single target is not broken down
+	resultChan = make(chan Result)
+	close(resultChan)
+	assert.Nil(t, ReadResults(1, resultChan, Options{Targets: []string{"primary:5432/tsdb"}}).Targets)
+}
+
+func TestReadResults_Breakdown(t *testing.T) {
+	resultChan := make(chan Result, 6)
+	resultChan <- Result{Worker: 0, Key: "host_000001", Latency: time.Millisecond}
+	resultChan <- Result{Worker: 0, Key: "host_000002", Latency: 2 * time.Millisecond}
+	resultChan <- Result{Worker: 1, Key: "host_000003", Latency: 40 * time.Millisecond}
+	resultChan <- Result{Worker: 1, Key: "host_000003", Err: fmt.Errorf("deadlock detected")}
+	resultChan <- Result{Worker: 1, Key: "host_000004", Latency: 10 * time.Millisecond}
+	resultChan <- Result{Worker: 1, Key: "host_000001", Warmup: true, Latency: time.Second}
+	close(resultChan)
+
+	report := ReadResults(2, resultChan, Options{WorkerBreakdown: true, KeyBreakdown: true, TopKeys: 2})
+	require.Len(t, report.Workers, 2)
+	assert.EqualValues(t, 2, report.Workers[0].QueriesOk)
+	assert.InDelta(t, 2.0, report.Workers[0].Max, 0.01)
+	assert.EqualValues(t, 2, report.Workers[1].QueriesOk)
+	assert.EqualValues(t, 1, report.Workers[1].QueriesErr)
+	assert.InDelta(t, 40.0, report.Workers[1].Max, 0.1)
+
+	// Keys are sorted from the slowest, the warmup is excluded
+	var keys []string
+	for _, k := range report.Keys {
+		keys = append(keys, k.Key)
+	}
+	assert.Equal(t, []string{"host_000003", "host_000004", "host_000002", "host_000001"}, keys)
+	assert.EqualValues(t, 1, report.Keys[0].QueriesErr)
+	assert.InDelta(t, 1.0, report.Keys[3].Max, 0.01)
+	assert.Len(t, report.SlowestKeys, 2)
+
+	buffer := strings.Builder{}
+	assert.NoError(t, report.Print(&buffer, false))
+	assert.Contains(t, buffer.String(), `
+Per-worker breakdown:
+  Worker 0: 2 completed, 0 failed (0% error rate)
+    Mean: 1.500 ms, Median: 1.000 ms, p95: 2.000 ms, p99: 2.000 ms, Max: 2.000 ms
+  Worker 1: 2 completed, 1 failed (34% error rate)
+`)
+	assert.Contains(t, buffer.String(), `
+Slowest routing keys (by p99 latency, 2 of 4):
+  host_000003: 1 completed, 1 failed (50% error rate)
+    Min: 40.000 ms, Mean: 40.000 ms, Median: 40.000 ms, p99: 40.000 ms, Max: 40.000 ms
+  host_000004: 1 completed, 0 failed (0% error rate)
+`)
+	assert.NotContains(t, buffer.String(), "host_000002")
+
+	// Only the summaries are kept by default
+	resultChan = make(chan Result)
+	close(resultChan)
+	report = ReadResults(2, resultChan, Options{})
+	assert.Nil(t, report.Workers)
+	assert.Nil(t, report.Keys)
+}
+
+func TestReadResults_QueueWait(t *testing.T) {
+	resultChan := make(chan Result, 3)
+	resultChan <- Result{Latency: time.Millisecond, QueueWait: 2 * time.Millisecond}
+	resultChan <- Result{Latency: time.Millisecond, QueueWait: 4 * time.Millisecond}
+	resultChan <- Result{Warmup: true, Latency: time.Millisecond, QueueWait: time.Second}
+	close(resultChan)
+
+	// Closed-loop queries are always queued, the wait is not flagged
+	report := ReadResults(1, resultChan, Options{})
+	require.NotNil(t, report.QueueWait)
+	assert.InDelta(t, 3.0, report.QueueWait.Mean, 0.01)
+	assert.InDelta(t, 4.0, report.QueueWait.Max, 0.01)
+	assert.False(t, report.QueueBound)
+
+	buffer := strings.Builder{}
+	assert.NoError(t, report.Print(&buffer, false))
+	assert.Contains(t, buffer.String(), "\nClient queue wait:\n  Min:    2.000 ms\n")
+	assert.NotContains(t, buffer.String(), "Warning")
+
+	resultChan = make(chan Result, 2)
+	resultChan <- Result{Latency: time.Millisecond, CorrectedLatency: 5 * time.Millisecond, QueueWait: 4 * time.Millisecond}
+	resultChan <- Result{Latency: 3 * time.Millisecond, CorrectedLatency: 3 * time.Millisecond}
+	close(resultChan)
+	report = ReadResults(1, resultChan, Options{})
+	assert.True(t, report.QueueBound)
+
+	buffer.Reset()
+	assert.NoError(t, report.Print(&buffer, false))
+	assert.Contains(t, buffer.String(), "\nWarning: queries waited longer in the client-side queues than they ran")
+}
+
+func TestReadResults_Explain(t *testing.T) {
+	resultChan := make(chan Result, 4)
+	resultChan <- Result{Latency: 2 * time.Millisecond}
+	resultChan <- Result{Explain: &ExplainSample{Planning: 100 * time.Microsecond, Execution: 1500 * time.Microsecond, SharedHit: 90, SharedRead: 10}}
+	resultChan <- Result{Explain: &ExplainSample{}, Err: fmt.Errorf("canceling statement due to statement timeout")}
+	resultChan <- Result{Latency: 2 * time.Millisecond}
+	close(resultChan)
+
+	// Explain results are not counted as queries
+	report := ReadResults(1, resultChan, Options{})
+	assert.EqualValues(t, 2, report.QueriesOk)
+	assert.EqualValues(t, 0, report.QueriesErr)
+	require.NotNil(t, report.Explain)
+	assert.EqualValues(t, 1, report.Explain.Samples)
+	assert.EqualValues(t, 1, report.Explain.Failed)
+	assert.InDelta(t, 1.5, report.Explain.Execution.Mean, 0.01)
+	assert.InDelta(t, 0.5, report.Explain.Overhead, 0.01)
+	assert.InDelta(t, 90.0, report.Explain.HitRatio(), 0.01)
+
+	buffer := strings.Builder{}
+	assert.NoError(t, report.Print(&buffer, false))
+	assert.Contains(t, buffer.String(), `
+Sampled server-side execution (EXPLAIN ANALYZE): 1 queries, 1 failed
+  Planning:   Mean: 0.100 ms, Median: 0.100 ms, p99: 0.100 ms, Max: 0.100 ms
+  Execution:  Mean: 1.500 ms, Median: 1.500 ms, p99: 1.500 ms, Max: 1.500 ms
+  Buffers:    90 hit, 10 read (90.0% hit ratio)
+  Estimated network and protocol overhead: 0.500 ms (mean client latency minus mean execution time)
+`)
+}
@@ -0,0 +1,61 @@
+package stats
+
+// StatementStats holds the pg_stat_statements counters of a statement, or their increase during the run.
+// Times are in milliseconds, temporary blocks count both the reads and writes.
+type StatementStats struct {
+	Calls            uint64  `json:"calls"`
+	TotalExecTime    float64 `json:"total_exec_time"`
+	MeanExecTime     float64 `json:"mean_exec_time"`
+	SharedBlocksHit  uint64  `json:"shared_blks_hit"`
+	SharedBlocksRead uint64  `json:"shared_blks_read"`
+	TempBlocks       uint64  `json:"temp_blks"`
+	WalBytes         uint64  `json:"wal_bytes"`
+}
+
+// Add sums the counters of another pg_stat_statements entry for the same statement.
+func (s *StatementStats) Add(other StatementStats) {
+	s.Calls += other.Calls
+	s.TotalExecTime += other.TotalExecTime
+	s.SharedBlocksHit += other.SharedBlocksHit
+	s.SharedBlocksRead += other.SharedBlocksRead
+	s.TempBlocks += other.TempBlocks
+	s.WalBytes += other.WalBytes
+	s.MeanExecTime = meanExecTime(s.TotalExecTime, s.Calls)
+}
+
+// StatementDeltas returns the increase of the counters of each statement between two snapshots.
+// Statements not called during the run are left out.
+func StatementDeltas(before, after map[string]StatementStats) map[string]*StatementStats {
+	deltas := make(map[string]*StatementStats)
+	for name, a := range after {
+		b := before[name]
+		if a.Calls <= b.Calls {
+			continue
+		}
+		deltas[name] = &StatementStats{
+			Calls:            a.Calls - b.Calls,
+			TotalExecTime:    a.TotalExecTime - b.TotalExecTime,
+			MeanExecTime:     meanExecTime(a.TotalExecTime-b.TotalExecTime, a.Calls-b.Calls),
+			SharedBlocksHit:  sub(a.SharedBlocksHit, b.SharedBlocksHit),
+			SharedBlocksRead: sub(a.SharedBlocksRead, b.SharedBlocksRead),
+			TempBlocks:       sub(a.TempBlocks, b.TempBlocks),
+			WalBytes:         sub(a.WalBytes, b.WalBytes),
+		}
+	}
+	return deltas
+}
+
+func meanExecTime(total float64, calls uint64) float64 {
+	if calls == 0 {
+		return 0
+	}
+	return total / float64(calls)
+}
+
+// sub returns a-b, or zero if the counter was reset.
+func sub(a, b uint64) uint64 {
+	if a < b {
+		return 0
+	}
+	return a - b
+}
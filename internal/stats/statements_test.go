@@ -0,0 +1,34 @@
+package stats
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatementDeltas(t *testing.T) {
+	before := map[string]StatementStats{
+		"cpu-buckets": {Calls: 10, TotalExecTime: 20, SharedBlocksHit: 100, SharedBlocksRead: 10, WalBytes: 0},
+		"idle":        {Calls: 5, TotalExecTime: 5},
+	}
+	after := map[string]StatementStats{
+		"cpu-buckets": {Calls: 110, TotalExecTime: 170, SharedBlocksHit: 1100, SharedBlocksRead: 12, TempBlocks: 4, WalBytes: 0},
+		"idle":        {Calls: 5, TotalExecTime: 5},
+		"insert":      {Calls: 3, TotalExecTime: 3, WalBytes: 300},
+	}
+	deltas := StatementDeltas(before, after)
+	assert.Equal(t, map[string]*StatementStats{
+		"cpu-buckets": {Calls: 100, TotalExecTime: 150, MeanExecTime: 1.5, SharedBlocksHit: 1000, SharedBlocksRead: 2, TempBlocks: 4},
+		"insert":      {Calls: 3, TotalExecTime: 3, MeanExecTime: 1, WalBytes: 300},
+	}, deltas)
+
+	report := &Report{ServerStatements: deltas}
+	buffer := strings.Builder{}
+	assert.NoError(t, report.Print(&buffer, false))
+	assert.Contains(t, buffer.String(), `
+Server-side statement statistics (pg_stat_statements):
+  cpu-buckets: 100 calls, mean execution 1.500 ms, total 150.000 ms
+    Shared blocks: 1000 hit, 2 read, temp blocks: 4, WAL: 0 bytes
+  insert: 3 calls,`)
+}